@@ -0,0 +1,301 @@
+package galog
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 500
+	defaultBatchBytes    = 1 << 20
+	defaultFlushInterval = time.Second
+	defaultQueueSize     = 10000
+	defaultCloseTimeout  = 10 * time.Second
+	defaultMaxRetries    = 5
+	defaultMinBackoff    = 500 * time.Millisecond
+	defaultMaxBackoff    = 30 * time.Second
+)
+
+// ErrQueueFull is returned by the remote handlers when a record was dropped
+// because too many are already waiting to be sent.
+var ErrQueueFull = errors.New("galog: handler queue is full")
+
+// BatchOptions configures how remote handlers group records into requests,
+// zero values use the defaults.
+type BatchOptions struct {
+	// BatchSize is the maximum number of records per request, 500 by default
+	BatchSize int
+
+	// BatchBytes is the maximum size of the records of a request, 1MiB by
+	// default
+	BatchBytes int
+
+	// FlushInterval is the longest a record waits before being sent, 1s by
+	// default
+	FlushInterval time.Duration
+
+	// QueueSize is the maximum number of records waiting to be sent, records
+	// are dropped with ErrQueueFull beyond it. 10000 by default.
+	QueueSize int
+
+	// CloseTimeout bounds how long Close waits for the queue to be sent,
+	// 10s by default. Records still queued then are dropped and reported to
+	// the ErrorHandler, so that Close returns when the collector is down.
+	CloseTimeout time.Duration
+}
+
+func (o *BatchOptions) setDefaults() {
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultBatchSize
+	}
+	if o.BatchBytes <= 0 {
+		o.BatchBytes = defaultBatchBytes
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultFlushInterval
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultQueueSize
+	}
+	if o.CloseTimeout <= 0 {
+		o.CloseTimeout = defaultCloseTimeout
+	}
+}
+
+// RetryOptions configures how remote handlers retry failed requests, zero
+// values use the defaults.
+type RetryOptions struct {
+	// MaxRetries after the first attempt, 5 by default, negative disables
+	// retrying
+	MaxRetries int
+
+	// MinBackoff is the wait before the first retry, 500ms by default
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the wait between retries, 30s by default
+	MaxBackoff time.Duration
+}
+
+func (o *RetryOptions) setDefaults() {
+	if o.MaxRetries == 0 {
+		o.MaxRetries = defaultMaxRetries
+	} else if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = defaultMinBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultMaxBackoff
+	}
+}
+
+// backoff returns the wait before retry attempt n (starting at 0): it
+// doubles with every attempt up to MaxBackoff, with a random jitter of up to
+// half of it so that clients do not retry in lockstep.
+func (o *RetryOptions) backoff(n int) time.Duration {
+	d := o.MinBackoff
+	for i := 0; i < n && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+type batchItem struct {
+	value interface{}
+	size  int
+}
+
+// batcher queues items and hands them to send in batches, from a
+// background goroutine, when BatchSize items or BatchBytes bytes are
+// waiting or FlushInterval elapsed. Batches left when close times out are
+// handed to drop instead, if set.
+type batcher struct {
+	opts     BatchOptions
+	send     func(items []interface{})
+	drop     func(items []interface{})
+	queue    chan batchItem
+	flushReq chan chan struct{}
+	done     chan struct{}
+	// closed when close timed out, the rest of the queue is dropped
+	abandon chan struct{}
+	mutex   sync.RWMutex
+	closed  bool
+}
+
+func newBatcher(opts BatchOptions, send func(items []interface{})) *batcher {
+	b := new(batcher)
+
+	b.opts = opts
+	b.send = send
+	b.queue = make(chan batchItem, opts.QueueSize)
+	b.flushReq = make(chan chan struct{})
+	b.done = make(chan struct{})
+	b.abandon = make(chan struct{})
+
+	go b.run()
+
+	return b
+}
+
+// add queues an item without blocking
+func (b *batcher) add(v interface{}, size int) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if b.closed {
+		return os.ErrClosed
+	}
+	select {
+	case b.queue <- batchItem{v, size}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var items []interface{}
+	size := 0
+	flush := func() {
+		if len(items) == 0 {
+			return
+		}
+		select {
+		case <-b.abandon:
+			if b.drop != nil {
+				b.drop(items)
+			}
+		default:
+			b.send(items)
+		}
+		items, size = nil, 0
+	}
+	push := func(item batchItem) {
+		if len(items) > 0 && size+item.size > b.opts.BatchBytes {
+			flush()
+		}
+		items = append(items, item.value)
+		size += item.size
+		if len(items) >= b.opts.BatchSize || size >= b.opts.BatchBytes {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case item, ok := <-b.queue:
+			if !ok {
+				flush()
+				return
+			}
+			push(item)
+		case <-ticker.C:
+			flush()
+		case ack := <-b.flushReq:
+			for drained := false; !drained; {
+				select {
+				case item, ok := <-b.queue:
+					if !ok {
+						drained = true
+						break
+					}
+					push(item)
+				default:
+					drained = true
+				}
+			}
+			flush()
+			close(ack)
+		}
+	}
+}
+
+// flush sends everything queued so far and waits for it
+func (b *batcher) flush() {
+	b.mutex.RLock()
+	if b.closed {
+		b.mutex.RUnlock()
+		return
+	}
+	ack := make(chan struct{})
+	b.flushReq <- ack
+	b.mutex.RUnlock()
+	<-ack
+}
+
+// close sends everything queued and stops the goroutine. It waits up to
+// CloseTimeout, the goroutine then drops what is left and stops once the
+// batch being sent returns, which the caller hastens by stopping retries.
+func (b *batcher) close() {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return
+	}
+	b.closed = true
+	close(b.queue)
+	b.mutex.Unlock()
+
+	timer := time.NewTimer(b.opts.CloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-b.done:
+	case <-timer.C:
+		close(b.abandon)
+	}
+}
+
+// deadLetter appends records that could not be delivered to a file, one per
+// line, so that they can be replayed by hand.
+type deadLetter struct {
+	fileName string
+	mutex    sync.Mutex
+}
+
+func (d *deadLetter) write(records [][]byte) error {
+	if d == nil {
+		return nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	f, err := open(d.fileName, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, r := range records {
+		if len(r) == 0 || r[len(r)-1] != '\n' {
+			r = append(r[:len(r):len(r)], '\n')
+		}
+		if _, err := f.Write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newDeadLetter(fileName string) *deadLetter {
+	if fileName == "" {
+		return nil
+	}
+	return &deadLetter{fileName: fileName}
+}
+
+func defaultErrorHandler(prefix string) func(error) {
+	return func(err error) {
+		fmt.Fprintf(os.Stderr, "%s, %v\n", prefix, err)
+	}
+}
@@ -0,0 +1,206 @@
+package galog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// ClientCrash 客户端崩溃上报，由服务器转发写入。
+// 客户端上报的自由文本 PageName、CrashType 和 Stack 写为 Go 语法的带引号字符串，`|` 转义为 \x7c；
+// CharName 与其它事件一样原样写入
+type ClientCrash struct {
+	ZoneID        int    // 游戏区编号
+	EventTime     string // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp     int64  // 时间戳，到毫秒，例如：1585903230000
+	GameID        int    // 游戏id
+	AccountID     string // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID        int    // 客户端平台 ios:2/android:1
+	CharID        string // 角色id
+	CharName      string // 角色名字 UTF-8编码
+	Level         int    // 角色触发当前事件时的等级
+	DeviceID      string // 设备ID（ios的idfa，android的imei或mac等）
+	ClientVersion string // 客户端版本
+	OS            string // 软件版本 操作系统版本
+	PhoneModel    string // 硬件机型 品牌-型号
+	CPU           string // cpu类型 cpu类型_频率_核数等
+	Memory        string // 内存，单位M
+	Network       string // 网络 WIFI/2G/3G/4G/5G
+	PageID        int    // 崩溃时所在场景id
+	PageName      string // 崩溃时所在场景名称，写入时转义为带引号的字符串
+	CrashType     string // 崩溃类型，如信号名 SIGSEGV 或异常类名，写入时转义为带引号的字符串
+	StackHash     string // 堆栈哈希，为空时由 sdk 根据 Stack 计算，同一崩溃在不同设备上相同
+	Stack         string // 堆栈，超过 SetClientStackLimit 的部分截掉，写入时转义为一行
+	StackSize     int    // 堆栈截断前的字节数，为 0 时由 sdk 填写为传入的 Stack 的长度，客户端已截断的堆栈按截断后的长度计
+	KvGroup       string // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var clientcrashLogger *Logger
+
+// default of SetClientStackLimit
+const defaultClientStackLimit = 4096
+
+var clientStackLimit int64 = defaultClientStackLimit
+
+// SetClientStackLimit sets the number of bytes of the stack of a
+// ClientCrash written, 4096 by default. The StackHash is computed on the
+// whole stack.
+func SetClientStackLimit(n int) {
+	atomic.StoreInt64(&clientStackLimit, int64(n))
+}
+
+// Log ClientCrash 写日志
+func (p ClientCrash) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext ClientCrash 写日志，附带 ctx 中的 trace_id 等字段
+func (p ClientCrash) LogContext(ctx context.Context) error {
+	if p.StackHash == "" && p.Stack != "" {
+		p.StackHash = StackHash(p.Stack)
+	}
+	if p.StackSize == 0 {
+		p.StackSize = len(p.Stack)
+	}
+	p.Stack = truncateUTF8(p.Stack, int(atomic.LoadInt64(&clientStackLimit)))
+
+	return clientcrashLogger.logEvent(ctx, "clientcrash", p, "ClientCrash - %d|%s|%d|%d|%s|%d|%s|%s|%d|%s|%s|%s|%s|%s|%s|%s|%d|%s|%s|%s|%s|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.DeviceID,
+		p.ClientVersion,
+		p.OS,
+		p.PhoneModel,
+		p.CPU,
+		p.Memory,
+		p.Network,
+		p.PageID,
+		quoteColumn(p.PageName),
+		quoteColumn(p.CrashType),
+		p.StackHash,
+		quoteColumn(p.Stack),
+		p.StackSize,
+		p.KvGroup)
+}
+
+// what differs between two occurrences of a crash: addresses, offsets and
+// line endings
+var (
+	stackAddress = regexp.MustCompile(`0x[0-9a-fA-F]+|\+\s*\d+\b`)
+	stackSpace   = regexp.MustCompile(`[ \t]+`)
+)
+
+// StackHash returns the hash ClientCrash computes for a stack: the first 16
+// bytes of the SHA-256, in hex, of the stack with addresses, offsets,
+// spacing and empty lines removed, so that it groups the same crash across
+// devices and builds loaded at different addresses.
+func StackHash(stack string) string {
+	lines := strings.Split(strings.Replace(stack, "\r\n", "\n", -1), "\n")
+	var normalized strings.Builder
+	for _, line := range lines {
+		line = stackAddress.ReplaceAllString(line, "")
+		line = strings.TrimSpace(stackSpace.ReplaceAllString(line, " "))
+		if line == "" {
+			continue
+		}
+		normalized.WriteString(line)
+		normalized.WriteByte('\n')
+	}
+	sum := sha256.Sum256([]byte(normalized.String()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// truncateUTF8 returns the first n bytes of s at most, without cutting a
+// character in two
+func truncateUTF8(s string, n int) string {
+	if n < 0 || len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// quoteColumn returns s as a Go quoted string, with the column separator
+// written \x7c, so that it fits one column of a line
+func quoteColumn(s string) string {
+	return strings.Replace(strconv.Quote(s), "|", `\x7c`, -1)
+}
+
+// ClientPerf 客户端性能上报，一段采样时间一条，由服务器转发写入。
+// PageName 与 ClientCrash 一样写为带引号的字符串，CharName 原样写入
+type ClientPerf struct {
+	ZoneID        int     // 游戏区编号
+	EventTime     string  // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp     int64   // 时间戳，到毫秒，例如：1585903230000
+	GameID        int     // 游戏id
+	AccountID     string  // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID        int     // 客户端平台 ios:2/android:1
+	CharID        string  // 角色id
+	CharName      string  // 角色名字 UTF-8编码
+	Level         int     // 角色触发当前事件时的等级
+	DeviceID      string  // 设备ID（ios的idfa，android的imei或mac等）
+	ClientVersion string  // 客户端版本
+	OS            string  // 软件版本 操作系统版本
+	PhoneModel    string  // 硬件机型 品牌-型号
+	CPU           string  // cpu类型 cpu类型_频率_核数等
+	Memory        string  // 内存，单位M
+	Network       string  // 网络 WIFI/2G/3G/4G/5G
+	PageID        int     // 采样所在场景id
+	PageName      string  // 采样所在场景名称，写入时转义为带引号的字符串
+	SampleTime    int     // 采样时长(秒)
+	AvgFPS        float64 // 平均帧率
+	P95FPS        float64 // 帧率的 P95，即 95% 的采样时间帧率不低于此值
+	MemoryPeak    int     // 内存峰值(M)
+	LoadTime      int     // 场景加载耗时(毫秒)，无加载为 0
+	KvGroup       string  // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var clientperfLogger *Logger
+
+// Log ClientPerf 写日志
+func (p ClientPerf) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext ClientPerf 写日志，附带 ctx 中的 trace_id 等字段
+func (p ClientPerf) LogContext(ctx context.Context) error {
+	return clientperfLogger.logEvent(ctx, "clientperf", p, "ClientPerf - %d|%s|%d|%d|%s|%d|%s|%s|%d|%s|%s|%s|%s|%s|%s|%s|%d|%s|%d|%.1f|%.1f|%d|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.DeviceID,
+		p.ClientVersion,
+		p.OS,
+		p.PhoneModel,
+		p.CPU,
+		p.Memory,
+		p.Network,
+		p.PageID,
+		quoteColumn(p.PageName),
+		p.SampleTime,
+		p.AvgFPS,
+		p.P95FPS,
+		p.MemoryPeak,
+		p.LoadTime,
+		p.KvGroup)
+}
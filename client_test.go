@@ -0,0 +1,69 @@
+package galog
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClientCrashColumns(t *testing.T) {
+	saved := clientcrashLogger
+	defer func() { clientcrashLogger = saved }()
+	out := new(lockedBuffer)
+	clientcrashLogger = New()
+	clientcrashLogger.SetFormatter(&TextFormatter{DisableFormat: true})
+	clientcrashLogger.SetOutput(nopCloser{out})
+	SetClientStackLimit(8)
+	defer SetClientStackLimit(defaultClientStackLimit)
+
+	err := ClientCrash{
+		CharName:  "a b",
+		PageName:  "town|2",
+		CrashType: "Null|Reference",
+		Stack:     "main|0x1\nrun 0x2",
+	}.Log()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := strings.TrimPrefix(strings.TrimSuffix(out.String(), "\n"), "ClientCrash - ")
+	columns := strings.Split(line, "|")
+	if len(columns) != 23 {
+		t.Fatalf("%d columns in %q, want 23", len(columns), line)
+	}
+	// CharName is raw like in the other events
+	if columns[7] != "a b" {
+		t.Errorf("char name %s, want it raw", columns[7])
+	}
+	for i, want := range map[int]string{17: "town|2", 18: "Null|Reference", 20: "main|0x1"} {
+		if got, err := strconv.Unquote(columns[i]); err != nil || got != want {
+			t.Errorf("column %d = %s, want %q", i, columns[i], want)
+		}
+	}
+	// the size of the stack as passed
+	if columns[21] != "16" {
+		t.Errorf("stack size %s, want 16", columns[21])
+	}
+}
+
+func TestClientPerfColumns(t *testing.T) {
+	saved := clientperfLogger
+	defer func() { clientperfLogger = saved }()
+	out := new(lockedBuffer)
+	clientperfLogger = New()
+	clientperfLogger.SetFormatter(&TextFormatter{DisableFormat: true})
+	clientperfLogger.SetOutput(nopCloser{out})
+
+	err := ClientPerf{CharName: "a b", PageName: "town|2", AvgFPS: 59.94, LoadTime: 800}.Log()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.TrimPrefix(strings.TrimSuffix(out.String(), "\n"), "ClientPerf - ")
+	columns := strings.Split(line, "|")
+	if len(columns) != 24 {
+		t.Fatalf("%d columns in %q, want 24", len(columns), line)
+	}
+	if columns[7] != "a b" || columns[17] != `"town\x7c2"` || columns[19] != "59.9" || columns[22] != "800" {
+		t.Errorf("columns %q", columns)
+	}
+}
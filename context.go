@@ -0,0 +1,143 @@
+package galog
+
+import (
+	"context"
+	"sync"
+)
+
+// ContextExtractor pulls the fields to log from a context, e.g. the trace
+// and span ids of a tracing library, or a session id.
+type ContextExtractor func(ctx context.Context) Fields
+
+type contextKey int
+
+const (
+	traceContextKey contextKey = iota
+	fieldsContextKey
+)
+
+type traceContext struct {
+	traceID string
+	spanID  string
+}
+
+var (
+	contextExtractors = []ContextExtractor{galogContextFields}
+	extractorsMutex   sync.RWMutex
+)
+
+// AddContextExtractor registers an extractor run for every entry logged
+// with a context, by any logger. Fields of extractors registered later win.
+// The fields set by ContextWithTrace and ContextWithFields are always
+// extracted.
+func AddContextExtractor(extractor ContextExtractor) {
+	extractorsMutex.Lock()
+	defer extractorsMutex.Unlock()
+	contextExtractors = append(contextExtractors, extractor)
+}
+
+// ContextWithTrace returns a copy of ctx carrying a trace id and a span id,
+// logged as "trace_id" and "span_id". Use it when the tracing library in use
+// has no extractor registered.
+func ContextWithTrace(ctx context.Context, traceID string, spanID string) context.Context {
+	return context.WithValue(ctx, traceContextKey, traceContext{traceID, spanID})
+}
+
+// ContextWithFields returns a copy of ctx carrying fields logged with every
+// entry logged with it, e.g. a session id. They are added to those already
+// carried by ctx.
+func ContextWithFields(ctx context.Context, fields Fields) context.Context {
+	merged := make(Fields)
+	if parent, ok := ctx.Value(fieldsContextKey).(Fields); ok {
+		for k, v := range parent {
+			merged[k] = v
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsContextKey, merged)
+}
+
+// galogContextFields extracts what ContextWithTrace and ContextWithFields
+// put in a context
+func galogContextFields(ctx context.Context) Fields {
+	fields := make(Fields)
+	if f, ok := ctx.Value(fieldsContextKey).(Fields); ok {
+		for k, v := range f {
+			fields[k] = v
+		}
+	}
+	if t, ok := ctx.Value(traceContextKey).(traceContext); ok {
+		fields["trace_id"] = t.traceID
+		fields["span_id"] = t.spanID
+	}
+	return fields
+}
+
+// contextFields runs the extractors on ctx
+func contextFields(ctx context.Context) Fields {
+	extractorsMutex.RLock()
+	extractors := contextExtractors
+	extractorsMutex.RUnlock()
+
+	fields := make(Fields)
+	for _, extract := range extractors {
+		for k, v := range extract(ctx) {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// WithContext returns a logger writing like this one, whose entries carry
+// ctx and the fields extracted from it.
+func (logger *Logger) WithContext(ctx context.Context) *Logger {
+	return &Logger{
+		parent: logger,
+		name:   logger.name,
+		ctx:    ctx,
+	}
+}
+
+// context returns the context the logger was bound to, nil if none
+func (logger *Logger) context() context.Context {
+	for l := logger; l != nil; l = l.parent {
+		if l.ctx != nil {
+			return l.ctx
+		}
+	}
+	return nil
+}
+
+func (logger *Logger) LogContext(ctx context.Context, level Level, args ...interface{}) error {
+	return logger.WithContext(ctx).Log(level, args...)
+}
+
+func (logger *Logger) TraceContext(ctx context.Context, args ...interface{}) error {
+	return logger.WithContext(ctx).Trace(args...)
+}
+
+func (logger *Logger) DebugContext(ctx context.Context, args ...interface{}) error {
+	return logger.WithContext(ctx).Debug(args...)
+}
+
+func (logger *Logger) InfoContext(ctx context.Context, args ...interface{}) error {
+	return logger.WithContext(ctx).Info(args...)
+}
+
+func (logger *Logger) WarnContext(ctx context.Context, args ...interface{}) error {
+	return logger.WithContext(ctx).Warn(args...)
+}
+
+func (logger *Logger) ErrorContext(ctx context.Context, args ...interface{}) error {
+	return logger.WithContext(ctx).Error(args...)
+}
+
+func (logger *Logger) FatalContext(ctx context.Context, args ...interface{}) error {
+	return logger.WithContext(ctx).Fatal(args...)
+}
+
+func (logger *Logger) PanicContext(ctx context.Context, args ...interface{}) error {
+	return logger.WithContext(ctx).Panic(args...)
+}
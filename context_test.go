@@ -0,0 +1,71 @@
+package galog
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestContextExtractors(t *testing.T) {
+	extractorsMutex.Lock()
+	saved := contextExtractors
+	extractorsMutex.Unlock()
+	defer func() {
+		extractorsMutex.Lock()
+		contextExtractors = saved
+		extractorsMutex.Unlock()
+	}()
+
+	ctx := ContextWithFields(context.Background(), Fields{"session": "s1", "zone_id": 1})
+	ctx = ContextWithFields(ctx, Fields{"zone_id": 2})
+	ctx = ContextWithTrace(ctx, "t1", "sp1")
+
+	fields := contextFields(ctx)
+	if len(fields) != 4 || fields["session"] != "s1" || fields["zone_id"] != 2 ||
+		fields["trace_id"] != "t1" || fields["span_id"] != "sp1" {
+		t.Fatalf("fields %v", fields)
+	}
+
+	// registered extractors run after the built-in one and win
+	AddContextExtractor(func(ctx context.Context) Fields {
+		return Fields{"trace_id": "from extractor", "tenant": "a"}
+	})
+	fields = contextFields(ctx)
+	if fields["trace_id"] != "from extractor" || fields["tenant"] != "a" || fields["session"] != "s1" {
+		t.Errorf("fields %v", fields)
+	}
+
+	if fields := contextFields(context.Background()); len(fields) != 2 {
+		t.Errorf("fields %v from an empty context", fields)
+	}
+}
+
+func TestLogContextTraceID(t *testing.T) {
+	ctx := ContextWithTrace(context.Background(), "t1", "sp1")
+
+	var out lockedBuffer
+	logger := New()
+	logger.SetFormatter(&JSONFormatter{DisableTimestamp: true})
+	logger.SetOutput(nopCloser{&out})
+	logger.LogContext(ctx, InfoLevel, "hello")
+	if s := out.String(); !strings.Contains(s, `"trace_id":"t1"`) || !strings.Contains(s, `"span_id":"sp1"`) {
+		t.Errorf("output %q", s)
+	}
+
+	// events carry them too, along with the context
+	saved := moneyflowLogger
+	defer func() { moneyflowLogger = saved }()
+	events := new(entryOutput)
+	moneyflowLogger = New()
+	moneyflowLogger.SetOutput(events)
+	if err := (MoneyFlow{ZoneID: 1, Reason: ReasonShop}).LogContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(events.entries) != 1 {
+		t.Fatalf("%d entries", len(events.entries))
+	}
+	e := events.entries[0]
+	if e.Event != "moneyflow" || e.Fields["trace_id"] != "t1" || e.Context != ctx {
+		t.Errorf("entry %+v", e)
+	}
+}
@@ -0,0 +1,113 @@
+package galog
+
+import (
+	"context"
+)
+
+// MoneyFlow 货币流水，每次货币变化一条
+type MoneyFlow struct {
+	ZoneID       int    // 游戏区编号
+	EventTime    string // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp    int64  // 时间戳，到毫秒，例如：1585903230000
+	GameID       int    // 游戏id
+	AccountID    string // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID       int    // 客户端平台 ios:2/android:1
+	CharID       string // 角色id
+	CharName     string // 角色名字 UTF-8编码
+	Level        int    // 角色触发当前事件时的等级
+	VipLevel     int    // 角色vip等级
+	MoneyType    int    // 货币类型，游戏内定义，如 1:金币 2:钻石 3:绑定钻石
+	Delta        int64  // 变化量，获得为正，消耗为负
+	BalanceAfter int64  // 变化后的余额
+	Reason       int    // 变化原因，见 RegisterReason
+	SubReason    int    // 子原因，原因内的细分，游戏内定义
+	OrderID      string // 关联订单号，如充值或商店订单，无则为空
+	KvGroup      string // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var moneyflowLogger *Logger
+
+// Log MoneyFlow 写日志
+func (p MoneyFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext MoneyFlow 写日志，附带 ctx 中的 trace_id 等字段
+func (p MoneyFlow) LogContext(ctx context.Context) error {
+	if err := checkReason(p.Reason); err != nil {
+		return err
+	}
+	return moneyflowLogger.logEvent(ctx, "moneyflow", p, "MoneyFlow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%d|%d|%d|%d|%d|%d|%s|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.VipLevel,
+		p.MoneyType,
+		p.Delta,
+		p.BalanceAfter,
+		p.Reason,
+		p.SubReason,
+		p.OrderID,
+		p.KvGroup)
+}
+
+// ItemFlow 道具流水，每次道具数量变化一条
+type ItemFlow struct {
+	ZoneID        int    // 游戏区编号
+	EventTime     string // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp     int64  // 时间戳，到毫秒，例如：1585903230000
+	GameID        int    // 游戏id
+	AccountID     string // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID        int    // 客户端平台 ios:2/android:1
+	CharID        string // 角色id
+	CharName      string // 角色名字 UTF-8编码
+	Level         int    // 角色触发当前事件时的等级
+	VipLevel      int    // 角色vip等级
+	ItemID        int    // 道具ID
+	ItemType      int    // 道具类型，游戏内定义
+	Delta         int64  // 数量变化，获得为正，消耗为负
+	CountAfter    int64  // 变化后的数量
+	Reason        int    // 变化原因，见 RegisterReason
+	SubReason     int    // 子原因，原因内的细分，游戏内定义
+	SourceEventID string // 来源事件ID，如掉落的对局 RoundID、邮件ID，无则为空
+	KvGroup       string // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var itemflowLogger *Logger
+
+// Log ItemFlow 写日志
+func (p ItemFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext ItemFlow 写日志，附带 ctx 中的 trace_id 等字段
+func (p ItemFlow) LogContext(ctx context.Context) error {
+	if err := checkReason(p.Reason); err != nil {
+		return err
+	}
+	return itemflowLogger.logEvent(ctx, "itemflow", p, "ItemFlow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%d|%d|%d|%d|%d|%d|%d|%s|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.VipLevel,
+		p.ItemID,
+		p.ItemType,
+		p.Delta,
+		p.CountAfter,
+		p.Reason,
+		p.SubReason,
+		p.SourceEventID,
+		p.KvGroup)
+}
@@ -0,0 +1,93 @@
+package galog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMoneyFlowColumns(t *testing.T) {
+	saved := moneyflowLogger
+	defer func() { moneyflowLogger = saved }()
+	out := new(lockedBuffer)
+	moneyflowLogger = New()
+	moneyflowLogger.SetFormatter(&TextFormatter{DisableFormat: true})
+	moneyflowLogger.SetOutput(nopCloser{out})
+
+	err := MoneyFlow{
+		ZoneID:       1,
+		CharID:       "c1",
+		MoneyType:    2,
+		Delta:        -30,
+		BalanceAfter: 70,
+		Reason:       ReasonShop,
+		SubReason:    5,
+		OrderID:      "o1",
+		KvGroup:      "{}",
+	}.Log()
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := strings.Split(strings.TrimSuffix(out.String(), "\n"), "|")
+	if len(columns) != 17 || columns[0] != "MoneyFlow - 1" {
+		t.Fatalf("columns %q", columns)
+	}
+	want := []string{"2", "-30", "70", "3", "5", "o1", "{}"}
+	if got := columns[10:]; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("columns %q, want %q", got, want)
+	}
+}
+
+func TestItemFlowColumns(t *testing.T) {
+	saved := itemflowLogger
+	defer func() { itemflowLogger = saved }()
+	out := new(lockedBuffer)
+	itemflowLogger = New()
+	itemflowLogger.SetFormatter(&TextFormatter{DisableFormat: true})
+	itemflowLogger.SetOutput(nopCloser{out})
+
+	err := ItemFlow{
+		ZoneID:        1,
+		CharID:        "c1",
+		ItemID:        1001,
+		ItemType:      3,
+		Delta:         2,
+		CountAfter:    5,
+		Reason:        ReasonBattle,
+		SubReason:     1,
+		SourceEventID: "r1",
+		KvGroup:       "{}",
+	}.Log()
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := strings.Split(strings.TrimSuffix(out.String(), "\n"), "|")
+	if len(columns) != 18 || columns[0] != "ItemFlow - 1" {
+		t.Fatalf("columns %q", columns)
+	}
+	want := []string{"1001", "3", "2", "5", "6", "1", "r1", "{}"}
+	if got := columns[10:]; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("columns %q, want %q", got, want)
+	}
+}
+
+func TestEconomyUnknownReason(t *testing.T) {
+	saved := moneyflowLogger
+	defer func() { moneyflowLogger = saved }()
+	out := new(lockedBuffer)
+	moneyflowLogger = New()
+	moneyflowLogger.SetOutput(nopCloser{out})
+
+	RequireRegisteredReasons(true)
+	defer RequireRegisteredReasons(false)
+
+	if err := (MoneyFlow{Reason: 99999}).Log(); !errors.Is(err, ErrUnknownReason) {
+		t.Errorf("error %v, want ErrUnknownReason", err)
+	}
+	if err := (ItemFlow{Reason: 99999}).Log(); !errors.Is(err, ErrUnknownReason) {
+		t.Errorf("error %v, want ErrUnknownReason", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("written %q", out.String())
+	}
+}
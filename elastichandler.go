@@ -0,0 +1,331 @@
+package galog
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultElasticIndexPrefix = "galog"
+	defaultElasticDateFormat  = "2006.01.02"
+)
+
+// ElasticOptions configures an ElasticHandler, zero values use the defaults.
+type ElasticOptions struct {
+	BatchOptions
+	RetryOptions
+
+	// IndexPrefix of the index names, "galog" by default. Documents go to
+	// "<prefix>-<event>-<date>", e.g. "galog-roundflow-2024.05.01", or
+	// "<prefix>-<date>" for entries that are not events.
+	IndexPrefix string
+
+	// DateFormat of the date in index names, "2006.01.02" by default
+	DateFormat string
+
+	// DocumentID derives the id of a document, so that sending it again,
+	// e.g. after a retry, does not index it twice. nil lets Elasticsearch
+	// pick an id. See EventDocumentID.
+	DocumentID func(entry *Entry, doc map[string]interface{}) string
+
+	// Header is added to every request, e.g. for authentication
+	Header http.Header
+
+	// Client used for requests, http.DefaultClient by default
+	Client *http.Client
+
+	// ErrorHandler receives delivery errors, they are printed on os.Stderr
+	// by default.
+	ErrorHandler func(error)
+}
+
+// EventDocumentID derives a document id from the event name, the entry time
+// and the document content, suitable for ElasticOptions.DocumentID.
+func EventDocumentID(entry *Entry, doc map[string]interface{}) string {
+	b, _ := json.Marshal(doc)
+	sum := sha1.Sum(append([]byte(entry.Event+"|"+entry.Time.Format(time.RFC3339Nano)+"|"), b...))
+	return hex.EncodeToString(sum[:])
+}
+
+type elasticDoc struct {
+	action []byte // bulk action line
+	source []byte // document line
+}
+
+// ElasticHandler indexes logs in Elasticsearch or OpenSearch with the bulk
+// API. Each document holds the fields of the entry along with "@timestamp",
+// "message", "level" and "logger", fields of the same name are renamed
+// "fields.<name>".
+//
+// Documents are sent in batches from a background goroutine, see
+// BatchOptions. Failed requests are retried as a whole; when the request
+// succeeds but some items fail, only those whose status is worth retrying
+// (429 and 5xx) are sent again.
+type ElasticHandler struct {
+	sender       *httpSender
+	batcher      *batcher
+	opts         ElasticOptions
+	errorHandler func(error)
+}
+
+// NewElasticHandler return ElasticHandler sending to the cluster at url,
+// e.g. "http://elasticsearch:9200"
+func NewElasticHandler(url string, opts ElasticOptions) (*ElasticHandler, error) {
+	h := new(ElasticHandler)
+
+	if opts.IndexPrefix == "" {
+		opts.IndexPrefix = defaultElasticIndexPrefix
+	}
+	if opts.DateFormat == "" {
+		opts.DateFormat = defaultElasticDateFormat
+	}
+	opts.BatchOptions.setDefaults()
+	opts.RetryOptions.setDefaults()
+
+	h.opts = opts
+	h.sender = newHTTPSender(strings.TrimRight(url, "/")+"/_bulk", opts.Client, opts.Header, false, opts.RetryOptions)
+	// the bulk API answers with an item per document, a large batch makes
+	// a large response
+	h.sender.fullResponse = true
+	h.errorHandler = opts.ErrorHandler
+	if h.errorHandler == nil {
+		h.errorHandler = defaultErrorHandler("Failed to index logs")
+	}
+	h.batcher = newBatcher(opts.BatchOptions, h.deliver)
+	h.batcher.drop = h.drop
+
+	return h, nil
+}
+
+// Write queues p as the message of a document
+func (h *ElasticHandler) Write(p []byte) (n int, err error) {
+	return h.WriteEntry(&Entry{Time: time.Now(), Level: InfoLevel}, p)
+}
+
+// keys of the attributes of the entry in the documents
+var elasticAttributes = []string{"@timestamp", "message", "level", "logger"}
+
+// WriteEntry queues a document made of the entry fields and p as its message
+func (h *ElasticHandler) WriteEntry(entry *Entry, p []byte) (n int, err error) {
+	d, err := h.doc(entry, p)
+	if err != nil {
+		return 0, err
+	}
+	if err := h.batcher.add(d, len(d.action)+len(d.source)+2); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// doc builds the bulk action and source of an entry
+func (h *ElasticHandler) doc(entry *Entry, p []byte) (*elasticDoc, error) {
+	doc := make(map[string]interface{}, len(entry.Fields)+4)
+	for k, v := range entry.Fields {
+		doc[fieldKey(k, elasticAttributes)] = jsonValue(v)
+	}
+	doc["@timestamp"] = entry.Time.Format(time.RFC3339Nano)
+	doc["message"] = strings.TrimSuffix(string(p), "\n")
+	doc["level"] = entry.Level.String()
+	if entry.Name != "" {
+		doc["logger"] = entry.Name
+	}
+
+	meta := map[string]string{"_index": h.index(entry)}
+	if h.opts.DocumentID != nil {
+		meta["_id"] = h.opts.DocumentID(entry, doc)
+	}
+
+	action, err := json.Marshal(map[string]interface{}{"index": meta})
+	if err != nil {
+		return nil, err
+	}
+	source, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &elasticDoc{action: action, source: source}, nil
+}
+
+func (h *ElasticHandler) index(entry *Entry) string {
+	date := entry.Time.UTC().Format(h.opts.DateFormat)
+	if entry.Event != "" {
+		return h.opts.IndexPrefix + "-" + strings.ToLower(entry.Event) + "-" + date
+	}
+	return h.opts.IndexPrefix + "-" + date
+}
+
+func (h *ElasticHandler) deliver(items []interface{}) {
+	docs := make([]*elasticDoc, len(items))
+	for i, item := range items {
+		docs[i] = item.(*elasticDoc)
+	}
+	if err := h.bulk(docs); err != nil {
+		h.errorHandler(err)
+	}
+}
+
+// bulk sends the documents, retrying the request and then the items that
+// failed with 429 or 5xx as configured. Documents rejected otherwise are
+// reported to the ErrorHandler, they would be rejected again; the error
+// returned is for those which could not be delivered.
+func (h *ElasticHandler) bulk(docs []*elasticDoc) error {
+	for attempt := 0; ; attempt++ {
+		failed, err := h.send(docs)
+		if err != nil {
+			return fmt.Errorf("%d documents lost, %v", len(docs), err)
+		}
+
+		var retry []*elasticDoc
+		var rejected, lost MultiError
+		for _, f := range failed {
+			switch {
+			case !f.retryable:
+				rejected = append(rejected, f)
+			case attempt < h.opts.MaxRetries:
+				retry = append(retry, docs[f.index])
+			default:
+				lost = append(lost, f)
+			}
+		}
+		if len(rejected) > 0 {
+			h.errorHandler(fmt.Errorf("%d documents rejected, %v", len(rejected), rejected))
+		}
+		if len(lost) > 0 {
+			return fmt.Errorf("%d documents lost, %v", len(lost), lost)
+		}
+		if len(retry) == 0 {
+			return nil
+		}
+		select {
+		case <-time.After(h.opts.backoff(attempt)):
+		case <-h.sender.stop:
+			return fmt.Errorf("%d documents lost, handler closed", len(retry))
+		}
+		docs = retry
+	}
+}
+
+// WriteEntryBatch sends records right away, bypassing the queue, and
+// returns once they are delivered or retries ran out. A nil entry stands
+// for a record written with Write. It makes ElasticHandler an
+// EntryBatchWriter, to be used as the output of a SpoolHandler.
+func (h *ElasticHandler) WriteEntryBatch(entries []*Entry, records [][]byte) error {
+	docs := make([]*elasticDoc, 0, len(records))
+	for i, p := range records {
+		entry := entries[i]
+		if entry == nil {
+			entry = &Entry{Time: time.Now(), Level: InfoLevel}
+		}
+		d, err := h.doc(entry, p)
+		if err != nil {
+			h.errorHandler(fmt.Errorf("document rejected, %v", err))
+			continue
+		}
+		docs = append(docs, d)
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	return h.bulk(docs)
+}
+
+// cancelBatch stops retrying, for SpoolHandler.Close
+func (h *ElasticHandler) cancelBatch() {
+	h.sender.close()
+}
+
+// elasticItemError is the failure of one item of a bulk request
+type elasticItemError struct {
+	index     int
+	status    int
+	retryable bool
+	reason    string
+}
+
+func (e *elasticItemError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.status, e.reason)
+}
+
+// bulkResponse is the part of the bulk API response we look at
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// send posts the documents in one bulk request and returns the items that
+// failed.
+func (h *ElasticHandler) send(docs []*elasticDoc) ([]*elasticItemError, error) {
+	var body bytes.Buffer
+	for _, d := range docs {
+		body.Write(d.action)
+		body.WriteByte('\n')
+		body.Write(d.source)
+		body.WriteByte('\n')
+	}
+
+	resp, err := h.sender.post(body.Bytes(), "application/x-ndjson")
+	if err != nil {
+		return nil, err
+	}
+
+	var br bulkResponse
+	if err := json.Unmarshal(resp, &br); err != nil {
+		return nil, fmt.Errorf("invalid bulk response, %v", err)
+	}
+	if !br.Errors {
+		return nil, nil
+	}
+
+	var failed []*elasticItemError
+	for i, item := range br.Items {
+		if i >= len(docs) {
+			break
+		}
+		for _, result := range item {
+			if result.Status >= 200 && result.Status <= 299 {
+				continue
+			}
+			f := &elasticItemError{
+				index:     i,
+				status:    result.Status,
+				retryable: result.Status == http.StatusTooManyRequests || result.Status >= 500,
+			}
+			if result.Error != nil {
+				f.reason = result.Error.Type + ": " + result.Error.Reason
+			}
+			failed = append(failed, f)
+		}
+	}
+	return failed, nil
+}
+
+// drop reports the documents left when Close timed out
+func (h *ElasticHandler) drop(items []interface{}) {
+	h.errorHandler(fmt.Errorf("%d documents dropped, handler closed", len(items)))
+}
+
+// Flush sends the queued documents and waits for the requests to complete
+func (h *ElasticHandler) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close sends the queued documents, retrying as configured, and stops the
+// handler. It waits up to CloseTimeout, the documents left are dropped.
+func (h *ElasticHandler) Close() error {
+	h.batcher.close()
+	h.sender.close()
+	return nil
+}
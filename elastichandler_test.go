@@ -0,0 +1,258 @@
+package galog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkServer is a fake bulk API, it records the documents posted to it and
+// answers each with the status returned by reply, 201 if nil
+type bulkServer struct {
+	mutex    sync.Mutex
+	requests [][]bulkRequestItem
+	reply    func(attempt int, source map[string]interface{}) (status int, reason string)
+}
+
+type bulkRequestItem struct {
+	index  string
+	source map[string]interface{}
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	var items []bulkRequestItem
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil || !scanner.Scan() {
+			http.Error(w, "invalid action line", http.StatusBadRequest)
+			return
+		}
+		var source map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &source); err != nil {
+			http.Error(w, "invalid source line", http.StatusBadRequest)
+			return
+		}
+		items = append(items, bulkRequestItem{action["index"]["_index"], source})
+	}
+
+	s.mutex.Lock()
+	attempt := len(s.requests)
+	s.requests = append(s.requests, items)
+	s.mutex.Unlock()
+
+	type result struct {
+		Status int                `json:"status"`
+		Error  *map[string]string `json:"error,omitempty"`
+	}
+	resp := struct {
+		Errors bool                `json:"errors"`
+		Items  []map[string]result `json:"items"`
+	}{}
+	for _, item := range items {
+		res := result{Status: http.StatusCreated}
+		if s.reply != nil {
+			status, reason := s.reply(attempt, item.source)
+			if status != 0 {
+				res.Status = status
+			}
+			if reason != "" {
+				res.Error = &map[string]string{"type": "error", "reason": reason}
+				resp.Errors = true
+			}
+		}
+		resp.Items = append(resp.Items, map[string]result{"index": res})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *bulkServer) received() [][]bulkRequestItem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([][]bulkRequestItem(nil), s.requests...)
+}
+
+func TestElasticHandlerDocuments(t *testing.T) {
+	s := new(bulkServer)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	h, err := NewElasticHandler(srv.URL+"/", ElasticOptions{
+		BatchOptions: BatchOptions{FlushInterval: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h.WriteEntry(&Entry{
+		Time:   now,
+		Level:  InfoLevel,
+		Name:   "game",
+		Event:  "RoundFlow",
+		Fields: Fields{"zone_id": 1, "level": 30},
+	}, []byte("round\n"))
+	h.WriteEntry(&Entry{Time: now, Level: ErrorLevel}, []byte("plain"))
+	// nothing is sent before Close with an hour long flush interval
+	h.Close()
+
+	requests := s.received()
+	if len(requests) != 1 || len(requests[0]) != 2 {
+		t.Fatalf("requests %v, want one of two documents", requests)
+	}
+	event, plain := requests[0][0], requests[0][1]
+	if event.index != "galog-roundflow-2024.05.01" || plain.index != "galog-2024.05.01" {
+		t.Errorf("indexes %q and %q", event.index, plain.index)
+	}
+	want := map[string]interface{}{
+		"@timestamp":   "2024-05-01T12:00:00Z",
+		"message":      "round",
+		"level":        "info",
+		"logger":       "game",
+		"zone_id":      float64(1),
+		"fields.level": float64(30),
+	}
+	for k, v := range want {
+		if event.source[k] != v {
+			t.Errorf("%s = %v, want %v", k, event.source[k], v)
+		}
+	}
+	if plain.source["level"] != "error" || plain.source["message"] != "plain" {
+		t.Errorf("document %v", plain.source)
+	}
+}
+
+func TestElasticHandlerUnencodableFields(t *testing.T) {
+	s := new(bulkServer)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	var errs []error
+	h, _ := NewElasticHandler(srv.URL, ElasticOptions{
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	_, err := h.WriteEntry(&Entry{
+		Time:  time.Now(),
+		Level: ErrorLevel,
+		Fields: Fields{
+			"ratio": math.NaN(),
+			"rate":  math.Inf(-1),
+			"err":   errors.New("disk full"),
+		},
+	}, []byte("failed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+
+	requests := s.received()
+	if len(requests) != 1 || len(requests[0]) != 1 || len(errs) != 0 {
+		t.Fatalf("requests %v, errors %v", requests, errs)
+	}
+	want := map[string]interface{}{"ratio": "NaN", "rate": "-Inf", "err": "disk full"}
+	for k, v := range want {
+		if got := requests[0][0].source[k]; got != v {
+			t.Errorf("%s = %v, want %v", k, got, v)
+		}
+	}
+}
+
+func TestElasticHandlerItemFailures(t *testing.T) {
+	s := &bulkServer{reply: func(attempt int, source map[string]interface{}) (int, string) {
+		switch {
+		case source["message"] == "throttled" && attempt == 0:
+			return http.StatusTooManyRequests, "too many requests"
+		case source["message"] == "invalid":
+			return http.StatusBadRequest, "mapper_parsing_exception"
+		}
+		return 0, ""
+	}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	var errs []error
+	h, _ := NewElasticHandler(srv.URL, ElasticOptions{
+		RetryOptions: fastRetry,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	h.Write([]byte("indexed"))
+	h.Write([]byte("throttled"))
+	h.Write([]byte("invalid"))
+	h.Close()
+
+	requests := s.received()
+	if len(requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(requests))
+	}
+	// only the document failing with 429 is sent again, 400 is rejected
+	if len(requests[1]) != 1 || requests[1][0].source["message"] != "throttled" {
+		t.Errorf("retried %v", requests[1])
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "mapper_parsing_exception") {
+		t.Errorf("errors %v, want the rejected document", errs)
+	}
+}
+
+func TestElasticHandlerLargeResponse(t *testing.T) {
+	// a response over the 1MiB read from other endpoints
+	reason := strings.Repeat("x", 1<<20)
+	s := &bulkServer{reply: func(attempt int, source map[string]interface{}) (int, string) {
+		return http.StatusBadRequest, reason
+	}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	var errs []error
+	h, _ := NewElasticHandler(srv.URL, ElasticOptions{
+		RetryOptions: fastRetry,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	h.Write([]byte("a"))
+	h.Write([]byte("b"))
+	h.Close()
+
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "2 documents rejected") {
+		t.Errorf("errors %.100v, want the documents rejected", errs)
+	}
+}
+
+func TestElasticHandlerCloseTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	errs := make(chan error, 2)
+	h, _ := NewElasticHandler(srv.URL, ElasticOptions{
+		BatchOptions: BatchOptions{BatchSize: 1, CloseTimeout: 50 * time.Millisecond},
+		RetryOptions: RetryOptions{MaxRetries: 100, MinBackoff: time.Minute, MaxBackoff: time.Minute},
+		ErrorHandler: func(err error) { errs <- err },
+	})
+	h.Write([]byte("a"))
+	h.Write([]byte("b"))
+
+	start := time.Now()
+	h.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Close took %v", d)
+	}
+	// the document being retried is lost, the other one dropped
+	for i := 0; i < 2; i++ {
+		select {
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d errors reported, want 2", i)
+		}
+	}
+}
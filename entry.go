@@ -0,0 +1,161 @@
+package galog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maximumCallerDepth = 25
+
+var (
+	// qualified package name, cached at first use
+	galogPackage   string
+	callerInitOnce sync.Once
+)
+
+// Entry is a single log record, it is handed to hooks, formatters and
+// handlers.
+type Entry struct {
+	Logger *Logger
+
+	// Time at which the entry was created
+	Time time.Time
+
+	// Level the entry was logged at
+	Level Level
+
+	// Message passed to Info, Warn, Error, ...
+	Message string
+
+	// Caller is the first frame outside of galog, nil if it could not be
+	// determined.
+	Caller *runtime.Frame
+
+	// Name of the logger, empty for the root logger, see Logger.Named
+	Name string
+
+	// Event is the name of the event logged, e.g. "playerlogin", empty for
+	// plain log lines
+	Event string
+
+	// Fields of the entry, e.g. the fields of the event, keyed in
+	// snake_case: "zone_id", "account_id", ..., and those extracted from
+	// Context
+	Fields Fields
+
+	// Context the entry was logged with, nil if none, see
+	// Logger.WithContext
+	Context context.Context
+}
+
+// Fields is the structured data attached to an entry
+type Fields map[string]interface{}
+
+// fieldKey returns the key a field is written under next to attributes,
+// the keys a handler gives to the level, the message, the logger name...
+// Every structured handler keeps its attributes under their key and
+// renames the fields clashing with them "fields.<key>", e.g. the "level"
+// of the events, which is the level of the character.
+func fieldKey(k string, attributes []string) string {
+	for _, a := range attributes {
+		if k == a {
+			return "fields." + k
+		}
+	}
+	return k
+}
+
+// jsonValue returns a field value that encoding/json accepts, so that one
+// field can not fail the whole entry: errors, which have no exported fields
+// and would be encoded as {}, become their message, NaN and infinities,
+// which JSON has no literal for, become strings, and anything else
+// json.Marshal rejects is printed with fmt.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return v
+	case error:
+		return v.Error()
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return v
+	case float32:
+		if f := float64(v); math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 32)
+		}
+		return v
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return v
+}
+
+// dup returns a copy of the entry, so that whoever receives it can not
+// affect what others see.
+func (entry *Entry) dup() *Entry {
+	e := *entry
+	if entry.Caller != nil {
+		caller := *entry.Caller
+		e.Caller = &caller
+	}
+	if entry.Fields != nil {
+		e.Fields = make(Fields, len(entry.Fields))
+		for k, v := range entry.Fields {
+			e.Fields[k] = v
+		}
+	}
+	return &e
+}
+
+// packages whose frames are skipped besides galog, those of the loggers
+// bridged to galog, see NewStdLogger and NewSlogHandler
+var bridgedPackages = map[string]bool{
+	"log":      true,
+	"log/slog": true,
+}
+
+// getCaller retrieves the name of the first non-galog calling function
+func getCaller() *runtime.Frame {
+	callerInitOnce.Do(func() {
+		pcs := make([]uintptr, 1)
+		runtime.Callers(1, pcs)
+		frame, _ := runtime.CallersFrames(pcs).Next()
+		galogPackage = getPackageName(frame.Function)
+	})
+
+	pcs := make([]uintptr, maximumCallerDepth)
+	depth := runtime.Callers(2, pcs)
+	if depth == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(pcs[:depth])
+
+	for {
+		f, more := frames.Next()
+		if pkg := getPackageName(f.Function); pkg != galogPackage && !bridgedPackages[pkg] {
+			return &f
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// getPackageName reduces a fully qualified function name to the package name
+func getPackageName(f string) string {
+	lastSlash := strings.LastIndex(f, "/")
+	if dot := strings.Index(f[lastSlash+1:], "."); dot >= 0 {
+		return f[:lastSlash+1+dot]
+	}
+	return f
+}
@@ -0,0 +1,118 @@
+package galog
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// eventFieldNames caches the snake_case field names of event types
+var eventFieldNames sync.Map // reflect.Type -> []string
+
+// whether event lines end with trace_id and span_id columns, 1 if they do.
+// It is read atomically as events may be logged while it is set.
+var eventTraceColumns int32
+
+// SetEventTraceColumns appends two columns to the lines of every event,
+// after the documented ones: the trace_id and span_id extracted from the
+// context the event was logged with, empty when there is none. Off by
+// default, as it changes the layout of the files.
+func SetEventTraceColumns(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&eventTraceColumns, v)
+}
+
+// logEvent writes the pipe separated line of an event at InfoLevel. When
+// outputs were added with AddOutput, the event fields, and those extracted
+// from ctx, are attached to the entry for them to ship structured records.
+func (logger *Logger) logEvent(ctx context.Context, event string, data interface{}, format string, args ...interface{}) error {
+	if !logger.IsLevelEnabled(InfoLevel) {
+		return nil
+	}
+	if ctx != nil && ctx != context.Background() {
+		logger = logger.WithContext(ctx)
+	}
+
+	entry := logger.newEntry(InfoLevel, fmt.Sprintf(format, args...))
+	entry.Event = event
+	// the files only need the line, the fields are for AddOutput handlers
+	if atomic.LoadInt32(&eventOutputCount) > 0 {
+		fields := eventFields(data)
+		if fields == nil {
+			fields = make(Fields, len(entry.Fields))
+		}
+		for k, v := range entry.Fields {
+			if _, ok := fields[k]; !ok {
+				fields[k] = v
+			}
+		}
+		entry.Fields = fields
+	}
+
+	if atomic.LoadInt32(&eventTraceColumns) == 1 {
+		entry.Message = fmt.Sprintf("%s|%v|%v\n", strings.TrimSuffix(entry.Message, "\n"),
+			stringField(entry.Fields, "trace_id"), stringField(entry.Fields, "span_id"))
+	}
+	return logger.write(entry)
+}
+
+func stringField(fields Fields, key string) string {
+	if v, ok := fields[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// eventFields returns the exported fields of an event struct, keyed by
+// their name in snake_case: ZoneID becomes "zone_id".
+func eventFields(data interface{}) Fields {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	t := v.Type()
+
+	names, ok := eventFieldNames.Load(t)
+	if !ok {
+		n := make([]string, t.NumField())
+		for i := range n {
+			if f := t.Field(i); f.PkgPath == "" {
+				n[i] = snakeCase(f.Name)
+			}
+		}
+		names, _ = eventFieldNames.LoadOrStore(t, n)
+	}
+
+	fields := make(Fields, t.NumField())
+	for i, name := range names.([]string) {
+		if name != "" {
+			fields[name] = v.Field(i).Interface()
+		}
+	}
+	return fields
+}
+
+// snakeCase converts a Go field name to snake_case, keeping acronyms
+// together: ClientIP becomes "client_ip", OSVersion "os_version".
+func snakeCase(s string) string {
+	runes := []rune(s)
+	out := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				out = append(out, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
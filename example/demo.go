@@ -1,7 +1,7 @@
 package main
 
 import (
-	"galog"
+	"github.com/ybm2dyd/galog"
 	"time"
 )
 
@@ -36,6 +36,11 @@ func (h *FileHandler) Write(b []byte) (n int, err error) {
 	return h.fd.Write(b)
 }
 
+// Flush commits the file to stable storage
+func (h *FileHandler) Flush() error {
+	return h.fd.Sync()
+}
+
 // Close file handler
 func (h *FileHandler) Close() error {
 	if h.fd != nil {
@@ -105,6 +110,13 @@ func (h *RotatingFileHandler) Write(p []byte) (n int, err error) {
 	return
 }
 
+// Flush commits the current file to stable storage
+func (h *RotatingFileHandler) Flush() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.fd.Sync()
+}
+
 // Close file handler
 func (h *RotatingFileHandler) Close() error {
 	if h.fd != nil {
@@ -152,6 +164,9 @@ type TimeRotatingFileHandler struct {
 	suffix     string
 	rolloverAt int64
 	mutex      sync.Mutex
+	perm       os.FileMode
+	// set on Close, for a lazy handler not to open its file afterwards
+	closed bool
 }
 
 type Rollingtime int
@@ -188,6 +203,14 @@ func rolloverAt(now time.Time, h *TimeRotatingFileHandler) error {
 
 // NewTimeRotatingFileHandler return TimeRotatingFileHandler
 func NewTimeRotatingFileHandler(baseName string, when Rollingtime, interval int) (*TimeRotatingFileHandler, error) {
+	return newTimeRotatingFileHandler(baseName, when, interval, 0666, false)
+}
+
+// newTimeRotatingFileHandler creates the files with perm, which is enforced
+// on existing ones too when stricter than the default. A lazy handler opens
+// its first file on the first write, so that files are only created for
+// what is logged.
+func newTimeRotatingFileHandler(baseName string, when Rollingtime, interval int, perm os.FileMode, lazy bool) (*TimeRotatingFileHandler, error) {
 	dir := path.Dir(baseName)
 	os.Mkdir(dir, 0777)
 
@@ -196,6 +219,7 @@ func NewTimeRotatingFileHandler(baseName string, when Rollingtime, interval int)
 	h.baseName = baseName
 	h.interval = int64(interval)
 	h.when = when
+	h.perm = perm
 
 	now := time.Now()
 	err := rolloverAt(now, h)
@@ -216,7 +240,10 @@ func NewTimeRotatingFileHandler(baseName string, when Rollingtime, interval int)
 		return nil, fmt.Errorf("invalid when_rotate: %d", h.when)
 	}
 
-	h.fd, err = open(h.baseName + "." + now.Format(h.suffix))
+	if lazy {
+		return h, nil
+	}
+	h.fd, err = open(h.baseName+"."+now.Format(h.suffix), h.perm)
 	if err != nil {
 		return nil, err
 	}
@@ -224,15 +251,39 @@ func NewTimeRotatingFileHandler(baseName string, when Rollingtime, interval int)
 	return h, nil
 }
 
+// file returns the current file, opening it for a lazy handler not written
+// yet
+func (h *TimeRotatingFileHandler) file() (*os.File, error) {
+	if fd := atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&h.fd))); fd != nil {
+		return (*os.File)(fd), nil
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.fd == nil {
+		if h.closed {
+			return nil, os.ErrClosed
+		}
+		fd, err := open(h.baseName+"."+time.Now().Format(h.suffix), h.perm)
+		if err != nil {
+			return nil, err
+		}
+		atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&h.fd)), unsafe.Pointer(fd))
+	}
+	return h.fd, nil
+}
+
 func (h *TimeRotatingFileHandler) doRollover() error {
 	//refer http://hg.python.org/cpython/file/2.7/Lib/logging/handlers.py
 	now := time.Now()
 	if h.rolloverAt > now.Unix() {
 		return nil
 	}
+	if h.closed {
+		return os.ErrClosed
+	}
 
 	fName := h.baseName + "." + now.Format(h.suffix)
-	newFd, err := open(fName)
+	newFd, err := open(fName, h.perm)
 	if err != nil {
 		return err
 	}
@@ -241,7 +292,9 @@ func (h *TimeRotatingFileHandler) doRollover() error {
 	if err != nil {
 		return err
 	}
-	(*os.File)(oldFd).Close()
+	if oldFd != nil {
+		(*os.File)(oldFd).Close()
+	}
 	return err
 }
 
@@ -253,8 +306,16 @@ func (h *TimeRotatingFileHandler) shouldRollover() bool {
 	return false
 }
 
-func open(fileName string) (*os.File, error) {
-	return os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+func open(fileName string, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm)
+	if err != nil || perm == 0666 {
+		return f, err
+	}
+	if err = f.Chmod(perm); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
 }
 
 func (h *TimeRotatingFileHandler) Write(b []byte) (n int, err error) {
@@ -267,10 +328,30 @@ func (h *TimeRotatingFileHandler) Write(b []byte) (n int, err error) {
 		}
 	}
 
-	return h.fd.Write(b)
+	fd, err := h.file()
+	if err != nil {
+		return 0, err
+	}
+	return fd.Write(b)
+}
+
+// Flush commits the current file to stable storage
+func (h *TimeRotatingFileHandler) Flush() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.fd == nil {
+		return nil
+	}
+	return h.fd.Sync()
 }
 
 // Close file handler
 func (h *TimeRotatingFileHandler) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.closed = true
+	if h.fd == nil {
+		return nil
+	}
 	return h.fd.Close()
 }
@@ -2,8 +2,9 @@ package galog
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
-	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -11,7 +12,6 @@ import (
 
 const (
 	defaultTimestampFormat = time.RFC3339
-	callDepth              = 5
 	red                    = 31
 	yellow                 = 33
 	purple                 = 34
@@ -25,6 +25,32 @@ type Formatter interface {
 	Format(level Level, buffer *bytes.Buffer, msg string) ([]byte, error)
 }
 
+// EntryFormatter is implemented by formatters which need the entry itself
+// and not only its level and message, e.g. to write its fields. The logger
+// calls FormatEntry instead of Format for them.
+type EntryFormatter interface {
+	Formatter
+	FormatEntry(entry *Entry, buffer *bytes.Buffer) ([]byte, error)
+}
+
+func format(f Formatter, entry *Entry, buffer *bytes.Buffer) ([]byte, error) {
+	if ef, ok := f.(EntryFormatter); ok {
+		return ef.FormatEntry(entry, buffer)
+	}
+	return f.Format(entry.Level, buffer, entry.Message)
+}
+
+// legacyEntry is the entry formatted by the Format methods of the
+// formatters of galog, for callers of the Formatter interface
+func legacyEntry(level Level, msg string) *Entry {
+	return &Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: msg,
+		Caller:  getCaller(),
+	}
+}
+
 // TextFormatter formats logs into text
 type TextFormatter struct {
 	// Force disabling colors.
@@ -40,13 +66,19 @@ type TextFormatter struct {
 	DisableFormat bool
 }
 
-// Format renders a single log entry
+// Format renders a message logged at level
 func (f *TextFormatter) Format(level Level, buffer *bytes.Buffer, msg string) ([]byte, error) {
+	return f.FormatEntry(legacyEntry(level, msg), buffer)
+}
+
+// FormatEntry renders a single log entry, the caller is left out when the
+// logger does not report it, see Logger.ReportCaller.
+func (f *TextFormatter) FormatEntry(entry *Entry, buffer *bytes.Buffer) ([]byte, error) {
 	if f.DisableFormat {
-		return []byte(msg), nil
+		return []byte(entry.Message), nil
 	} else {
 		var levelColor int
-		switch level {
+		switch entry.Level {
 		case DebugLevel, TraceLevel:
 			levelColor = gray
 		case WarnLevel:
@@ -59,7 +91,7 @@ func (f *TextFormatter) Format(level Level, buffer *bytes.Buffer, msg string) ([
 			levelColor = blue
 		}
 
-		levelText := strings.ToUpper(level.String())
+		levelText := strings.ToUpper(entry.Level.String())
 
 		timestampFormat := f.TimestampFormat
 		if timestampFormat == "" {
@@ -70,32 +102,100 @@ func (f *TextFormatter) Format(level Level, buffer *bytes.Buffer, msg string) ([
 			fmt.Fprintf(buffer, "\x1b[%dm", levelColor)
 		}
 		if !f.DisableTimestamp {
-			fmt.Fprintf(buffer, "%-5s [%s]", levelText, time.Now().Format(timestampFormat))
+			fmt.Fprintf(buffer, "%-5s [%s]", levelText, entry.Time.Format(timestampFormat))
 		} else {
 			fmt.Fprintf(buffer, "%-5s", levelText)
 		}
+		if entry.Name != "" {
+			buffer.WriteString(" " + entry.Name)
+		}
 
-		pc, file, line, ok := runtime.Caller(callDepth)
-		pcName := "???"
-		if !ok {
-			file = "???"
-			line = 0
-		} else {
-			pcName = runtime.FuncForPC(pc).Name()
+		if entry.Caller != nil {
+			file, line, pcName := entry.Caller.File, entry.Caller.Line, entry.Caller.Function
 			for i := len(file) - 1; i > 0; i-- {
 				if file[i] == '/' {
 					file = file[i+1:]
 					break
 				}
 			}
+			buffer.WriteString(" " + file + ":" + strconv.FormatInt(int64(line), 10) + " " + pcName)
 		}
-		buffer.WriteString(" " + file + ":" + strconv.FormatInt(int64(line), 10) + " " + pcName)
 
 		if !f.DisableColors {
 			buffer.WriteString("\x1b[0m")
 		}
-		buffer.WriteString(" " + msg)
+		if len(entry.Fields) == 0 {
+			buffer.WriteString(" " + entry.Message)
+		} else {
+			msg := strings.TrimSuffix(entry.Message, "\n")
+			buffer.WriteString(" " + msg)
+			for _, k := range sortedKeys(entry.Fields) {
+				fmt.Fprintf(buffer, " %s=%v", k, entry.Fields[k])
+			}
+			if len(msg) < len(entry.Message) {
+				buffer.WriteByte('\n')
+			}
+		}
 	}
 
 	return buffer.Bytes(), nil
 }
+
+// sortedKeys returns the keys of fields in order, so that lines are stable
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// JSONFormatter formats logs into one JSON object per line, the fields of
+// the entry are keys of the object. A field clashing with one of the keys
+// set by the formatter is renamed "fields.<key>".
+type JSONFormatter struct {
+	// TimestampFormat to use for the time field, defaults to RFC3339
+	TimestampFormat string
+
+	// DisableTimestamp leaves the time field out
+	DisableTimestamp bool
+}
+
+// keys of the attributes of the entry written by JSONFormatter
+var jsonAttributes = []string{"time", "level", "msg", "logger", "caller", "func"}
+
+// Format renders a message logged at level
+func (f *JSONFormatter) Format(level Level, buffer *bytes.Buffer, msg string) ([]byte, error) {
+	return f.FormatEntry(legacyEntry(level, msg), buffer)
+}
+
+// FormatEntry renders a single log entry
+func (f *JSONFormatter) FormatEntry(entry *Entry, buffer *bytes.Buffer) ([]byte, error) {
+	data := make(map[string]interface{}, len(entry.Fields)+5)
+	for k, v := range entry.Fields {
+		data[fieldKey(k, jsonAttributes)] = jsonValue(v)
+	}
+
+	if !f.DisableTimestamp {
+		timestampFormat := f.TimestampFormat
+		if timestampFormat == "" {
+			timestampFormat = defaultTimestampFormat
+		}
+		data["time"] = entry.Time.Format(timestampFormat)
+	}
+	data["level"] = entry.Level.String()
+	data["msg"] = strings.TrimSuffix(entry.Message, "\n")
+	if entry.Name != "" {
+		data["logger"] = entry.Name
+	}
+	if entry.Caller != nil {
+		data["caller"] = entry.Caller.File + ":" + strconv.Itoa(entry.Caller.Line)
+		data["func"] = entry.Caller.Function
+	}
+
+	if err := json.NewEncoder(buffer).Encode(data); err != nil {
+		return nil, fmt.Errorf("failed to marshal entry to JSON, %v", err)
+	}
+	return buffer.Bytes(), nil
+}
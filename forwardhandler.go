@@ -0,0 +1,342 @@
+package galog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultForwardTagPrefix = "galog"
+	defaultForwardTimeout   = 10 * time.Second
+)
+
+// ForwardOptions configures a ForwardHandler, zero values use the defaults.
+type ForwardOptions struct {
+	BatchOptions
+	RetryOptions
+
+	// TagPrefix of the tags records are sent with, "galog" by default.
+	// Events are tagged with their name, e.g. "galog.playerlogin", other
+	// entries with the name of their logger, "galog.battle", or just the
+	// prefix.
+	TagPrefix string
+
+	// RequireAck asks the server to acknowledge every chunk of records, a
+	// chunk is sent again until it is or MaxRetries run out, the records
+	// are then reported lost to the ErrorHandler.
+	RequireAck bool
+
+	// Timeout for connecting, sending and waiting for an ack, 10s by default
+	Timeout time.Duration
+
+	// ErrorHandler receives delivery errors, they are printed on os.Stderr
+	// by default.
+	ErrorHandler func(error)
+}
+
+type forwardRecord struct {
+	tag    string
+	time   time.Time
+	record map[string]interface{}
+}
+
+// ForwardHandler sends records to a fluentd or fluent-bit server speaking
+// the Forward protocol, over tcp or a unix socket.
+//
+// Records are queued and sent in batches from a background goroutine, see
+// BatchOptions, one Forward mode message per tag. Each record holds the
+// fields of the entry along with "message", "level" and "logger", fields of
+// the same name are renamed "fields.<name>".
+type ForwardHandler struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	network      string
+	addr         string
+	opts         ForwardOptions
+	batcher      *batcher
+	errorHandler func(error)
+	// closed by Close, to stop waiting between retries
+	stop     chan struct{}
+	stopOnce sync.Once
+	mutex    sync.Mutex
+}
+
+// NewForwardHandler return ForwardHandler
+func NewForwardHandler(network string, addr string, opts ForwardOptions) (*ForwardHandler, error) {
+	h := new(ForwardHandler)
+
+	if opts.TagPrefix == "" {
+		opts.TagPrefix = defaultForwardTagPrefix
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultForwardTimeout
+	}
+	opts.BatchOptions.setDefaults()
+	opts.RetryOptions.setDefaults()
+
+	h.network = network
+	h.addr = addr
+	h.opts = opts
+	h.stop = make(chan struct{})
+	h.errorHandler = opts.ErrorHandler
+	if h.errorHandler == nil {
+		h.errorHandler = defaultErrorHandler("Failed to forward logs")
+	}
+
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+	h.batcher = newBatcher(opts.BatchOptions, h.deliver)
+	h.batcher.drop = h.drop
+
+	return h, nil
+}
+
+func (h *ForwardHandler) connect() error {
+	conn, err := net.DialTimeout(h.network, h.addr, h.opts.Timeout)
+	if err != nil {
+		return err
+	}
+	h.mutex.Lock()
+	h.conn = conn
+	h.reader = bufio.NewReader(conn)
+	h.mutex.Unlock()
+	return nil
+}
+
+func (h *ForwardHandler) disconnect() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.conn != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+}
+
+// Write queues p as the message of a record tagged with TagPrefix
+func (h *ForwardHandler) Write(p []byte) (n int, err error) {
+	return h.add(h.record(nil, p), len(p))
+}
+
+// WriteEntry queues a record made of the entry fields and p as its message
+func (h *ForwardHandler) WriteEntry(entry *Entry, p []byte) (n int, err error) {
+	return h.add(h.record(entry, p), len(p))
+}
+
+// record builds the record of an entry, with p as its message alone if
+// entry is nil
+func (h *ForwardHandler) record(entry *Entry, p []byte) *forwardRecord {
+	message := strings.TrimSuffix(string(p), "\n")
+	if entry == nil {
+		return &forwardRecord{
+			tag:    h.opts.TagPrefix,
+			time:   time.Now(),
+			record: map[string]interface{}{"message": message},
+		}
+	}
+
+	record := make(map[string]interface{}, len(entry.Fields)+3)
+	for k, v := range entry.Fields {
+		record[fieldKey(k, forwardAttributes)] = v
+	}
+	record["message"] = message
+	record["level"] = entry.Level.String()
+	if entry.Name != "" {
+		record["logger"] = entry.Name
+	}
+	return &forwardRecord{
+		tag:    h.tag(entry),
+		time:   entry.Time,
+		record: record,
+	}
+}
+
+// keys of the attributes of the entry in the records
+var forwardAttributes = []string{"message", "level", "logger"}
+
+func (h *ForwardHandler) add(r *forwardRecord, n int) (int, error) {
+	if err := h.batcher.add(r, n+16*len(r.record)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (h *ForwardHandler) tag(entry *Entry) string {
+	switch {
+	case entry.Event != "":
+		return h.opts.TagPrefix + "." + entry.Event
+	case entry.Name != "":
+		return h.opts.TagPrefix + "." + entry.Name
+	}
+	return h.opts.TagPrefix
+}
+
+// deliver sends a batch of queued records
+func (h *ForwardHandler) deliver(items []interface{}) {
+	records := make([]*forwardRecord, len(items))
+	for i, item := range items {
+		records[i] = item.(*forwardRecord)
+	}
+	for _, err := range h.sendAll(records) {
+		h.errorHandler(err)
+	}
+}
+
+// sendAll sends records, grouped by tag in order of first appearance, and
+// returns an error for each tag whose records were lost.
+func (h *ForwardHandler) sendAll(records []*forwardRecord) MultiError {
+	var tags []string
+	byTag := make(map[string][]*forwardRecord)
+	for _, r := range records {
+		if _, ok := byTag[r.tag]; !ok {
+			tags = append(tags, r.tag)
+		}
+		byTag[r.tag] = append(byTag[r.tag], r)
+	}
+
+	var errs MultiError
+	for _, tag := range tags {
+		if err := h.send(tag, byTag[tag]); err != nil {
+			errs = append(errs, fmt.Errorf("%d records tagged %s lost, %v", len(byTag[tag]), tag, err))
+		}
+	}
+	return errs
+}
+
+// WriteEntryBatch sends records right away, bypassing the queue, and
+// returns once they are delivered or retries ran out. A nil entry stands
+// for a record written with Write. It makes ForwardHandler an
+// EntryBatchWriter, to be used as the output of a SpoolHandler.
+func (h *ForwardHandler) WriteEntryBatch(entries []*Entry, records [][]byte) error {
+	batch := make([]*forwardRecord, len(records))
+	for i, p := range records {
+		batch[i] = h.record(entries[i], p)
+	}
+	return h.sendAll(batch).err()
+}
+
+// cancelBatch stops retrying, for SpoolHandler.Close
+func (h *ForwardHandler) cancelBatch() {
+	h.stopOnce.Do(func() { close(h.stop) })
+}
+
+// drop reports the records left when Close timed out
+func (h *ForwardHandler) drop(items []interface{}) {
+	h.errorHandler(fmt.Errorf("%d records dropped, handler closed", len(items)))
+}
+
+func (h *ForwardHandler) send(tag string, records []*forwardRecord) error {
+	chunk := ""
+	if h.opts.RequireAck {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+	msg := encodeForwardMessage(tag, records, chunk)
+
+	for attempt := 0; ; attempt++ {
+		err := h.sendOnce(msg, chunk)
+		if err == nil {
+			return nil
+		}
+		h.disconnect()
+		if attempt >= h.opts.MaxRetries {
+			return err
+		}
+		select {
+		case <-time.After(h.opts.backoff(attempt)):
+		case <-h.stop:
+			return err
+		}
+	}
+}
+
+func (h *ForwardHandler) sendOnce(msg []byte, chunk string) error {
+	h.mutex.Lock()
+	connected := h.conn != nil
+	h.mutex.Unlock()
+	if !connected {
+		select {
+		case <-h.stop:
+			// a batch still retried after Close timed out
+			return fmt.Errorf("galog: forward handler is closed")
+		default:
+		}
+		if err := h.connect(); err != nil {
+			return err
+		}
+	}
+
+	h.mutex.Lock()
+	conn, reader := h.conn, h.reader
+	h.mutex.Unlock()
+	if conn == nil {
+		return fmt.Errorf("galog: forward handler is closed")
+	}
+
+	conn.SetDeadline(time.Now().Add(h.opts.Timeout))
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	resp, err := decodeMsgpackStringMap(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read ack, %v", err)
+	}
+	if resp["ack"] != chunk {
+		return fmt.Errorf("unexpected ack %q for chunk %q", resp["ack"], chunk)
+	}
+	return nil
+}
+
+// encodeForwardMessage builds a Forward mode message:
+// [tag, [[time, record], ...], {"size": n, "chunk": id}]
+func encodeForwardMessage(tag string, records []*forwardRecord, chunk string) []byte {
+	var buf bytes.Buffer
+	e := msgpackEncoder{&buf}
+
+	e.encodeArrayLen(3)
+	e.encodeString(tag)
+	e.encodeArrayLen(len(records))
+	for _, r := range records {
+		e.encodeArrayLen(2)
+		e.encodeEventTime(r.time)
+		e.encodeMap(r.record)
+	}
+
+	option := map[string]interface{}{"size": len(records)}
+	if chunk != "" {
+		option["chunk"] = chunk
+	}
+	e.encodeMap(option)
+
+	return buf.Bytes()
+}
+
+// Flush sends the queued records and waits for them to be acknowledged
+func (h *ForwardHandler) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close sends the queued records, retrying as configured, and closes the
+// connection. It waits up to CloseTimeout, the records left are dropped.
+func (h *ForwardHandler) Close() error {
+	h.batcher.close()
+	h.stopOnce.Do(func() { close(h.stop) })
+	h.disconnect()
+	return nil
+}
@@ -0,0 +1,213 @@
+package galog
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// forwardServer is an in-process Fluentd, it acknowledges the chunks it
+// receives except the first dropAcks ones
+type forwardServer struct {
+	l        net.Listener
+	messages chan []interface{}
+	dropAcks int32
+}
+
+func newForwardServer(t *testing.T, dropAcks int) *forwardServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &forwardServer{l: l, messages: make(chan []interface{}, 100), dropAcks: int32(dropAcks)}
+	go s.serve()
+	return s
+}
+
+func (s *forwardServer) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *forwardServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		v, err := testDecodeMsgpack(r)
+		if err != nil {
+			return
+		}
+		msg := v.([]interface{})
+		s.messages <- msg
+		option := msg[2].(map[string]interface{})
+		chunk, ok := option["chunk"].(string)
+		if !ok {
+			continue
+		}
+		if atomic.AddInt32(&s.dropAcks, -1) >= 0 {
+			return
+		}
+		var buf bytes.Buffer
+		msgpackEncoder{&buf}.encodeMap(map[string]interface{}{"ack": chunk})
+		conn.Write(buf.Bytes())
+	}
+}
+
+func (s *forwardServer) next(t *testing.T) []interface{} {
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	return nil
+}
+
+func TestForwardHandler(t *testing.T) {
+	s := newForwardServer(t, 0)
+	defer s.l.Close()
+
+	h, err := NewForwardHandler("tcp", s.l.Addr().String(), ForwardOptions{
+		BatchOptions: BatchOptions{FlushInterval: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1585903230, 5)
+	h.WriteEntry(&Entry{Time: now, Level: WarnLevel, Event: "playerlogin", Fields: Fields{"level": 12, "zone_id": 1}}, []byte("line\n"))
+	h.WriteEntry(&Entry{Time: now, Level: InfoLevel, Name: "battle"}, []byte("other\n"))
+	// Close sends what is queued
+	h.Close()
+
+	msg := s.next(t)
+	if msg[0] != "galog.playerlogin" {
+		t.Errorf("tag %v", msg[0])
+	}
+	entries := msg[1].([]interface{})
+	if len(entries) != 1 {
+		t.Fatalf("%d entries, want 1", len(entries))
+	}
+	entry := entries[0].([]interface{})
+	if !entry[0].(time.Time).Equal(now) {
+		t.Errorf("time %v, want %v", entry[0], now)
+	}
+	record := entry[1].(map[string]interface{})
+	want := map[string]interface{}{
+		"message":      "line",
+		"level":        "warn",
+		"fields.level": int64(12),
+		"zone_id":      int64(1),
+	}
+	for k, v := range want {
+		if record[k] != v {
+			t.Errorf("record[%q] = %v, want %v", k, record[k], v)
+		}
+	}
+	if msg[2].(map[string]interface{})["size"] != int64(1) {
+		t.Errorf("option %v", msg[2])
+	}
+
+	if msg := s.next(t); msg[0] != "galog.battle" {
+		t.Errorf("tag %v, want galog.battle", msg[0])
+	}
+}
+
+func TestForwardHandlerResendsUnacknowledged(t *testing.T) {
+	s := newForwardServer(t, 1)
+	defer s.l.Close()
+
+	var errs []error
+	h, err := NewForwardHandler("tcp", s.l.Addr().String(), ForwardOptions{
+		RetryOptions: fastRetry,
+		RequireAck:   true,
+		Timeout:      time.Second,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write([]byte("important\n"))
+	h.Flush()
+	h.Close()
+
+	first, second := s.next(t), s.next(t)
+	chunk := first[2].(map[string]interface{})["chunk"]
+	if chunk == nil || second[2].(map[string]interface{})["chunk"] != chunk {
+		t.Errorf("chunks %v and %v, want the same one resent", first[2], second[2])
+	}
+	if len(errs) != 0 {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestForwardHandlerCloseSendsQueued(t *testing.T) {
+	s := newForwardServer(t, 1)
+	defer s.l.Close()
+
+	var errs []error
+	h, err := NewForwardHandler("tcp", s.l.Addr().String(), ForwardOptions{
+		BatchOptions: BatchOptions{FlushInterval: time.Hour},
+		RetryOptions: fastRetry,
+		RequireAck:   true,
+		Timeout:      time.Second,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write([]byte("queued\n"))
+	// the record is still retried while Close drains the queue
+	h.Close()
+	h.Close()
+
+	s.next(t)
+	s.next(t)
+	if len(errs) != 0 {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestEventFieldsOnlyWithOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := Init(dir, WhenDay, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer Clean()
+
+	var fields Fields
+	hook := &recordHook{}
+	playerloginLogger.AddAfterHook(hook)
+
+	Playerlogin{ZoneID: 1, Level: 12}.Log()
+	if fields = hook.entries[0].Fields; fields != nil {
+		t.Errorf("fields %v built without outputs", fields)
+	}
+
+	s := newForwardServer(t, 0)
+	defer s.l.Close()
+	h, err := NewForwardHandler("tcp", s.l.Addr().String(), ForwardOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddOutput(h); err != nil {
+		t.Fatal(err)
+	}
+	Playerlogin{ZoneID: 1, Level: 12}.Log()
+	if fields = hook.entries[1].Fields; fields["zone_id"] != 1 || fields["level"] != 12 {
+		t.Errorf("fields %v", fields)
+	}
+}
@@ -0,0 +1,272 @@
+package galog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GachaResult 抽卡的一个结果
+type GachaResult struct {
+	ItemID int // 道具ID
+	Rarity int // 稀有度，游戏内定义，如 3:R 4:SR 5:SSR
+	Count  int // 数量
+}
+
+// GachaResults is the results of a draw, in the order they were drawn. In
+// the files it is written as "ItemID:Rarity:Count" items separated by ";",
+// e.g. "1001:5:1;2003:3:1".
+type GachaResults []GachaResult
+
+// String returns the results in the format of the files
+func (r GachaResults) String() string {
+	var b strings.Builder
+	for i, res := range r {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(strconv.Itoa(res.ItemID))
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(res.Rarity))
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(res.Count))
+	}
+	return b.String()
+}
+
+// ParseGachaResults parses results written by GachaResults.String
+func ParseGachaResults(s string) (GachaResults, error) {
+	if s == "" {
+		return nil, nil
+	}
+	items := strings.Split(s, ";")
+	results := make(GachaResults, len(items))
+	for i, item := range items {
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("galog: invalid gacha result %q", item)
+		}
+		var n [3]int
+		for j, part := range parts {
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("galog: invalid gacha result %q", item)
+			}
+			n[j] = v
+		}
+		results[i] = GachaResult{ItemID: n[0], Rarity: n[1], Count: n[2]}
+	}
+	return results, nil
+}
+
+// GachaFlow 抽卡流水，每次抽卡（单抽或十连）一条
+type GachaFlow struct {
+	ZoneID     int          // 游戏区编号
+	EventTime  string       // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp  int64        // 时间戳，到毫秒，例如：1585903230000
+	GameID     int          // 游戏id
+	AccountID  string       // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID     int          // 客户端平台 ios:2/android:1
+	CharID     string       // 角色id
+	CharName   string       // 角色名字 UTF-8编码，与其它事件一样原样写入
+	Level      int          // 角色触发当前事件时的等级
+	VipLevel   int          // 角色vip等级
+	PoolID     int          // 卡池ID
+	DrawCount  int          // 抽取次数，如 1 或 10，统计出率的分母
+	Results    GachaResults // 抽取结果，按抽取顺序，格式见 GachaResults
+	CostType   int          // 消耗的货币或道具类型
+	CostAmount int64        // 消耗数量
+	PityBefore int          // 抽取前的保底计数
+	PityAfter  int          // 抽取后的保底计数
+	Guaranteed int          // 本次是否触发保底 1:是 0:否
+	KvGroup    string       // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var gachaflowLogger *Logger
+
+// Log GachaFlow 写日志
+func (p GachaFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext GachaFlow 写日志，附带 ctx 中的 trace_id 等字段
+func (p GachaFlow) LogContext(ctx context.Context) error {
+	return gachaflowLogger.logEvent(ctx, "gachaflow", p, "GachaFlow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%d|%d|%d|%s|%d|%d|%d|%d|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.VipLevel,
+		p.PoolID,
+		p.DrawCount,
+		p.Results,
+		p.CostType,
+		p.CostAmount,
+		p.PityBefore,
+		p.PityAfter,
+		p.Guaranteed,
+		p.KvGroup)
+}
+
+// columns of the gachaflow lines read by GachaAggregator. CharName is
+// written raw like in every event and may span several columns, the others
+// are counted from the end of it.
+const (
+	gachaNameColumn       = 7
+	gachaPoolColumn       = 2
+	gachaDrawCountColumn  = 3
+	gachaResultsColumn    = 4
+	gachaGuaranteedColumn = 9
+	gachaTrailingColumns  = 11
+)
+
+// GachaPoolStats is what GachaAggregator observed for a pool.
+type GachaPoolStats struct {
+	PoolID int
+	// Records is the number of GachaFlow lines, Guaranteed how many of them
+	// triggered the guarantee
+	Records    int64
+	Guaranteed int64
+	// Pulls is the sum of the DrawCount of the records, a ten-pull counts
+	// ten. Records without a DrawCount count their number of results.
+	Pulls int64
+	// ByRarity and ByItem are the number of items obtained, the sum of the
+	// Count of the results
+	ByRarity map[int]int64
+	ByItem   map[int]int64
+}
+
+// RarityRate returns the observed number of items of rarity per pull
+func (s *GachaPoolStats) RarityRate(rarity int) float64 {
+	if s.Pulls == 0 {
+		return 0
+	}
+	return float64(s.ByRarity[rarity]) / float64(s.Pulls)
+}
+
+// ItemRate returns the observed number of itemID per pull
+func (s *GachaPoolStats) ItemRate(itemID int) float64 {
+	if s.Pulls == 0 {
+		return 0
+	}
+	return float64(s.ByItem[itemID]) / float64(s.Pulls)
+}
+
+// GachaAggregator computes the observed rates of the pools from gachaflow
+// files, for the drop rate reports:
+//
+//	var a galog.GachaAggregator
+//	for _, f := range files {
+//		if err := a.AddFile(f); err != nil { ... }
+//	}
+//	for _, s := range a.Pools() {
+//		fmt.Println(s.PoolID, s.RarityRate(5))
+//	}
+type GachaAggregator struct {
+	pools map[int]*GachaPoolStats
+}
+
+// AddFile adds the lines of a gachaflow file, lines of other events are
+// skipped.
+func (a *GachaAggregator) AddFile(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		if err := a.AddLine(scanner.Text()); err != nil {
+			return fmt.Errorf("%s line %d: %v", fileName, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// AddLine adds one gachaflow line, lines of other events are skipped.
+// CharName and the KvGroup ending the line may hold any '|'.
+func (a *GachaAggregator) AddLine(line string) error {
+	if !strings.HasPrefix(line, "GachaFlow - ") {
+		return nil
+	}
+	columns, ok := gachaColumnsAfterName(strings.Split(strings.TrimPrefix(line, "GachaFlow - "), "|"))
+	if !ok {
+		return fmt.Errorf("galog: invalid gachaflow line %q", line)
+	}
+	poolID, _ := strconv.Atoi(columns[gachaPoolColumn])
+	drawCount, _ := strconv.Atoi(columns[gachaDrawCountColumn])
+	results, _ := ParseGachaResults(columns[gachaResultsColumn])
+
+	if a.pools == nil {
+		a.pools = make(map[int]*GachaPoolStats)
+	}
+	s, ok := a.pools[poolID]
+	if !ok {
+		s = &GachaPoolStats{
+			PoolID:   poolID,
+			ByRarity: make(map[int]int64),
+			ByItem:   make(map[int]int64),
+		}
+		a.pools[poolID] = s
+	}
+	s.Records++
+	if columns[gachaGuaranteedColumn] == "1" {
+		s.Guaranteed++
+	}
+	if drawCount > 0 {
+		s.Pulls += int64(drawCount)
+	} else {
+		s.Pulls += int64(len(results))
+	}
+	for _, r := range results {
+		s.ByRarity[r.Rarity] += int64(r.Count)
+		s.ByItem[r.ItemID] += int64(r.Count)
+	}
+	return nil
+}
+
+// gachaColumnsAfterName returns the columns following CharName: the first
+// run of columns in the format of Level up to Guaranteed, so that a name
+// holding '|' does not shift them.
+func gachaColumnsAfterName(columns []string) ([]string, bool) {
+	for end := gachaNameColumn + 1; end+gachaTrailingColumns <= len(columns); end++ {
+		after := columns[end:]
+		valid := true
+		for i := 0; i < gachaTrailingColumns-1 && valid; i++ {
+			if i == gachaResultsColumn {
+				_, err := ParseGachaResults(after[i])
+				valid = err == nil
+			} else {
+				_, err := strconv.ParseInt(after[i], 10, 64)
+				valid = err == nil
+			}
+		}
+		if valid {
+			return after, true
+		}
+	}
+	return nil, false
+}
+
+// Pools returns the stats of the pools seen, by pool ID
+func (a *GachaAggregator) Pools() []*GachaPoolStats {
+	pools := make([]*GachaPoolStats, 0, len(a.pools))
+	for _, s := range a.pools {
+		pools = append(pools, s)
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].PoolID < pools[j].PoolID })
+	return pools
+}
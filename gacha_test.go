@@ -0,0 +1,68 @@
+package galog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGachaAggregator(t *testing.T) {
+	saved := gachaflowLogger
+	defer func() { gachaflowLogger = saved }()
+	out := new(lockedBuffer)
+	gachaflowLogger = New()
+	gachaflowLogger.SetFormatter(&TextFormatter{DisableFormat: true})
+	gachaflowLogger.SetOutput(nopCloser{out})
+
+	draws := []GachaFlow{
+		// a ten-pull: one SSR, two copies of an R from one pull
+		{CharName: "a|b", PoolID: 7, DrawCount: 10, Guaranteed: 1, KvGroup: `{"note":"x|y"}`, Results: GachaResults{
+			{ItemID: 1001, Rarity: 5, Count: 1},
+			{ItemID: 2001, Rarity: 3, Count: 2},
+		}},
+		{CharName: "c", PoolID: 7, DrawCount: 1, Results: GachaResults{
+			{ItemID: 2001, Rarity: 3, Count: 1},
+		}},
+		{PoolID: 8, DrawCount: 1},
+	}
+	for _, d := range draws {
+		if err := d.Log(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// CharName is raw like in the other events, AddLine finds the columns
+	// after it
+	if !strings.Contains(out.String(), "|a|b|0|0|7|10|") {
+		t.Fatalf("lines %q", out.String())
+	}
+
+	var a GachaAggregator
+	a.AddLine("Playerlogin - 1|2") // other events are skipped
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if err := a.AddLine(line); err != nil {
+			t.Fatalf("%v: %q", err, line)
+		}
+	}
+
+	pools := a.Pools()
+	if len(pools) != 2 || pools[0].PoolID != 7 || pools[1].PoolID != 8 {
+		t.Fatalf("pools %v", pools)
+	}
+	s := pools[0]
+	if s.Records != 2 || s.Guaranteed != 1 || s.Pulls != 11 {
+		t.Errorf("records %d, guaranteed %d, pulls %d", s.Records, s.Guaranteed, s.Pulls)
+	}
+	if s.ByRarity[5] != 1 || s.ByRarity[3] != 3 || s.ByItem[2001] != 3 {
+		t.Errorf("by rarity %v, by item %v", s.ByRarity, s.ByItem)
+	}
+	if rate := s.RarityRate(3); rate != 3.0/11 {
+		t.Errorf("R rate %v, want 3/11", rate)
+	}
+	if s := pools[1]; s.Pulls != 1 || s.RarityRate(5) != 0 {
+		t.Errorf("empty draw %+v", s)
+	}
+
+	if err := a.AddLine("GachaFlow - 1|2|3"); err == nil {
+		t.Error("truncated line accepted")
+	}
+}
@@ -0,0 +1,250 @@
+package galog
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultGELFChunkSize = 1420
+	maxGELFChunks        = 128
+	gelfChunkHeaderSize  = 12
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// GELFCompression selects how GELF messages sent over UDP are compressed
+type GELFCompression int
+
+const (
+	// GELFCompressNone sends messages as plain JSON
+	GELFCompressNone GELFCompression = iota
+	// GELFCompressGzip compresses messages with gzip
+	GELFCompressGzip
+	// GELFCompressZlib compresses messages with zlib
+	GELFCompressZlib
+)
+
+// GELFOptions configures a GELFHandler, zero values use the defaults.
+type GELFOptions struct {
+	// Host sent in messages, os.Hostname() by default
+	Host string
+
+	// Compression of UDP messages, none by default. TCP does not support
+	// compression, it is ignored.
+	Compression GELFCompression
+
+	// ChunkSize is the maximum size of a UDP datagram, larger messages are
+	// split in chunks. 1420 by default.
+	ChunkSize int
+
+	// Fields are additional fields added to every message, e.g. "facility".
+	// "id" is reserved by GELF, it is left out.
+	Fields Fields
+}
+
+// GELFHandler sends logs to Graylog in GELF 1.1, over udp, chunked when
+// needed, or tcp, null byte delimited.
+//
+// The short_message is the formatted line, the level is mapped to a syslog
+// severity, and the entry fields are sent as additional fields prefixed with
+// an underscore, e.g. "_account_id". Fields named like the additional fields
+// set from the entry, "_logger", "_event", "_file" and "_line", or like the
+// reserved "_id" are renamed "_fields.<name>".
+type GELFHandler struct {
+	conn   net.Conn
+	closed bool
+
+	network string
+	addr    string
+	opts    GELFOptions
+	mutex   sync.Mutex
+}
+
+// NewGELFHandler return GELFHandler, network is "udp" or "tcp"
+func NewGELFHandler(network string, addr string, opts GELFOptions) (*GELFHandler, error) {
+	h := new(GELFHandler)
+
+	if !strings.HasPrefix(network, "udp") && !strings.HasPrefix(network, "tcp") {
+		return nil, fmt.Errorf("invalid gelf network: %s", network)
+	}
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	if opts.ChunkSize <= gelfChunkHeaderSize {
+		opts.ChunkSize = defaultGELFChunkSize
+	}
+
+	fields := make(Fields, len(opts.Fields))
+	for k, v := range opts.Fields {
+		if k != "id" {
+			fields[k] = v
+		}
+	}
+	opts.Fields = fields
+
+	h.network = network
+	h.addr = addr
+	h.opts = opts
+
+	var err error
+	h.conn, err = net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Write p with the severity of InfoLevel
+func (h *GELFHandler) Write(p []byte) (n int, err error) {
+	return h.WriteEntry(&Entry{Time: time.Now(), Level: InfoLevel}, p)
+}
+
+// WriteEntry sends the entry as a GELF message, with p as short_message
+func (h *GELFHandler) WriteEntry(entry *Entry, p []byte) (n int, err error) {
+	msg, err := h.message(entry, p)
+	if err != nil {
+		return 0, err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	if h.conn == nil {
+		if h.conn, err = net.Dial(h.network, h.addr); err != nil {
+			return 0, err
+		}
+	}
+	if strings.HasPrefix(h.network, "udp") {
+		err = h.writeUDP(msg)
+	} else {
+		_, err = h.conn.Write(append(msg, 0))
+	}
+	if err != nil {
+		// dial again on the next message, the server may have restarted
+		h.conn.Close()
+		h.conn = nil
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// gelfFieldName replaces what GELF does not accept in field names
+var gelfFieldName = regexp.MustCompile(`[^\w\.\-]`)
+
+// additional fields set from the entry, and "id" which GELF reserves
+var gelfAttributes = []string{"id", "logger", "event", "file", "line"}
+
+func (h *GELFHandler) message(entry *Entry, p []byte) ([]byte, error) {
+	msg := make(map[string]interface{}, len(h.opts.Fields)+len(entry.Fields)+8)
+	for k, v := range h.opts.Fields {
+		msg["_"+gelfFieldName.ReplaceAllString(k, "_")] = jsonValue(v)
+	}
+	for k, v := range entry.Fields {
+		msg["_"+gelfFieldName.ReplaceAllString(fieldKey(k, gelfAttributes), "_")] = jsonValue(v)
+	}
+	if entry.Name != "" {
+		msg["_logger"] = entry.Name
+	}
+	if entry.Event != "" {
+		msg["_event"] = entry.Event
+	}
+	if entry.Caller != nil {
+		msg["_file"] = entry.Caller.File
+		msg["_line"] = entry.Caller.Line
+	}
+
+	msg["version"] = "1.1"
+	msg["host"] = h.opts.Host
+	msg["short_message"] = strings.TrimRight(string(p), "\n")
+	msg["timestamp"] = float64(entry.Time.UnixNano()/int64(time.Millisecond)) / 1000
+	msg["level"] = syslogSeverity(entry.Level)
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal gelf message, %v", err)
+	}
+	return b, nil
+}
+
+func (h *GELFHandler) writeUDP(msg []byte) error {
+	var err error
+	switch h.opts.Compression {
+	case GELFCompressGzip:
+		msg, err = gzipBytes(msg)
+	case GELFCompressZlib:
+		msg, err = zlibBytes(msg)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(msg) <= h.opts.ChunkSize {
+		_, err = h.conn.Write(msg)
+		return err
+	}
+
+	size := h.opts.ChunkSize - gelfChunkHeaderSize
+	count := (len(msg) + size - 1) / size
+	if count > maxGELFChunks {
+		return fmt.Errorf("gelf message too large: %d bytes in %d chunks", len(msg), count)
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+	chunk := make([]byte, 0, h.opts.ChunkSize)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk = append(chunk[:0], gelfChunkMagic...)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*size:end]...)
+		if _, err := h.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func zlibBytes(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(p); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Close the connection, writes fail with os.ErrClosed afterwards
+func (h *GELFHandler) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.closed = true
+	if h.conn != nil {
+		err := h.conn.Close()
+		h.conn = nil
+		return err
+	}
+	return nil
+}
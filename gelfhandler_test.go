@@ -0,0 +1,180 @@
+package galog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGELFHandlerUDPChunks(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	h, err := NewGELFHandler("udp", conn.LocalAddr().String(), GELFOptions{
+		Host:        "game-1",
+		Compression: GELFCompressZlib,
+		ChunkSize:   100,
+		Fields:      Fields{"facility": "galog", "id": "reserved"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// random text does not compress, so that the message is chunked
+	random := make([]byte, 600)
+	rand.Read(random)
+	long := base64.StdEncoding.EncodeToString(random)
+	entry := &Entry{Time: time.Unix(1585903230, 0), Level: ErrorLevel, Event: "chatflow", Fields: Fields{"id": 7, "zone_id": 1, "text": long}}
+	if _, err := h.WriteEntry(entry, []byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// reassemble the chunks
+	var chunks [][]byte
+	buf := make([]byte, 2048)
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := append([]byte(nil), buf[:n]...)
+		if !bytes.HasPrefix(c, gelfChunkMagic) {
+			chunks = [][]byte{c}
+			break
+		}
+		if len(c) > 100 {
+			t.Fatalf("chunk of %d bytes, want at most 100", len(c))
+		}
+		if chunks == nil {
+			chunks = make([][]byte, c[11])
+		}
+		chunks[c[10]] = c[gelfChunkHeaderSize:]
+		done := true
+		for _, c := range chunks {
+			done = done && c != nil
+		}
+		if done {
+			break
+		}
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("%d chunks, want several", len(chunks))
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(bytes.Join(chunks, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(zr)
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "game-1",
+		"short_message": "line",
+		"level":         float64(severityErr),
+		"timestamp":     float64(1585903230),
+		"_facility":     "galog",
+		"_event":        "chatflow",
+		"_fields.id":    float64(7),
+		"_zone_id":      float64(1),
+	}
+	for k, v := range want {
+		if msg[k] != v {
+			t.Errorf("%s = %v, want %v", k, msg[k], v)
+		}
+	}
+	if _, ok := msg["_id"]; ok {
+		t.Errorf("reserved _id sent: %v", msg["_id"])
+	}
+}
+
+func TestGELFHandlerTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		msg, _ := bufio.NewReader(conn).ReadString(0)
+		received <- msg
+	}()
+
+	h, err := NewGELFHandler("tcp", l.Addr().String(), GELFOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write([]byte("hello\n"))
+	select {
+	case msg := <-received:
+		if !strings.HasSuffix(msg, "\x00") || !strings.Contains(msg, `"short_message":"hello"`) {
+			t.Errorf("got %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing received")
+	}
+
+	h.Close()
+	if _, err := h.Write([]byte("after close")); err != os.ErrClosed {
+		t.Errorf("write after Close returned %v, want os.ErrClosed", err)
+	}
+}
+
+func TestGELFHandlerUnencodableFields(t *testing.T) {
+	h := &GELFHandler{opts: GELFOptions{Host: "zone3"}}
+	b, err := h.message(&Entry{
+		Time:  time.Unix(1, 0),
+		Level: ErrorLevel,
+		Fields: Fields{
+			"ratio": math.NaN(),
+			"rate":  math.Inf(1),
+			"err":   errors.New("disk full"),
+			"ch":    make(chan int),
+		},
+	}, []byte("failed\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"_ratio":        "NaN",
+		"_rate":         "+Inf",
+		"_err":          "disk full",
+		"short_message": "failed",
+	}
+	for k, v := range want {
+		if msg[k] != v {
+			t.Errorf("%s = %v, want %v", k, msg[k], v)
+		}
+	}
+	if _, ok := msg["_ch"].(string); !ok {
+		t.Errorf("_ch = %v, want it printed", msg["_ch"])
+	}
+}
@@ -0,0 +1,254 @@
+package galog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// GMAudit GM/运营操作审计，写入 gmaudit 文件，每行末尾附加 HMAC 链，见 SetGMAuditKey
+type GMAudit struct {
+	ZoneID          int    // 游戏区编号
+	EventTime       string // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp       int64  // 时间戳，到毫秒，例如：1585903230000
+	GameID          int    // 游戏id
+	OperatorID      string // 操作人 GM 账号
+	OperatorName    string // 操作人名字 UTF-8编码
+	Action          string // 操作，如 kick/ban/grant_item/set_level
+	TargetAccountID string // 目标账号ID，无则为空
+	TargetCharID    string // 目标角色id，无则为空
+	Params          string // 操作参数，JSON，写入时压缩为一行
+	ClientIP        string // 操作人 IP 地址
+	TicketID        string // 审批单号，无则为空
+	Result          int    // 操作结果 1:成功 2:失败
+	KvGroup         string // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var (
+	gmauditLogger *Logger
+	gmauditKey    []byte
+)
+
+// ErrAuditTampered is returned by VerifyGMAudit when a file does not match
+// its HMAC chain: a line was modified, inserted or deleted.
+var ErrAuditTampered = errors.New("galog: audit chain broken")
+
+// SetGMAuditKey sets the HMAC-SHA256 key chaining the lines of the gmaudit
+// files, and makes Init open them. Call it before Init, GMAudit can not be
+// logged without a key. Keep the key away from the machines holding the
+// files, anyone with it can rewrite them undetected.
+func SetGMAuditKey(key []byte) {
+	gmauditKey = append([]byte(nil), key...)
+}
+
+// Log GMAudit 写日志
+func (p GMAudit) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext GMAudit 写日志，附带 ctx 中的 trace_id 等字段
+func (p GMAudit) LogContext(ctx context.Context) error {
+	if gmauditLogger == nil {
+		return errors.New("galog: GMAudit logged without SetGMAuditKey and Init")
+	}
+	if p.Params != "" {
+		var params bytes.Buffer
+		if err := json.Compact(&params, []byte(p.Params)); err != nil {
+			return fmt.Errorf("galog: GMAudit.Params is not JSON: %v", err)
+		}
+		p.Params = params.String()
+	}
+	return gmauditLogger.logEvent(ctx, "gmaudit", p, "GMAudit - %d|%s|%d|%d|%s|%s|%s|%s|%s|%s|%s|%s|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.OperatorID,
+		p.OperatorName,
+		p.Action,
+		p.TargetAccountID,
+		p.TargetCharID,
+		p.Params,
+		p.ClientIP,
+		p.TicketID,
+		p.Result,
+		p.KvGroup)
+}
+
+// auditChainHandler appends to each line the HMAC of the line and of the
+// HMAC of the previous line of the same file: mac = HMAC(key, prev + line),
+// prev being empty for the first line of a file.
+type auditChainHandler struct {
+	h     *TimeRotatingFileHandler
+	key   []byte
+	mutex sync.Mutex
+	// file the chain is on and its last mac, in hex
+	file string
+	prev []byte
+}
+
+func (c *auditChainHandler) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// rotate first, the chain starts over with the new file
+	if c.h.shouldRollover() {
+		c.h.mutex.Lock()
+		err := c.h.doRollover()
+		c.h.mutex.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+	fd, err := c.h.file()
+	if err != nil {
+		return 0, err
+	}
+	if fd.Name() != c.file {
+		// resume the chain of a file written before a restart
+		prev, end, err := lastAuditMAC(fd.Name())
+		if err != nil {
+			return 0, err
+		}
+		// a line cut short by a crash would run into the next one
+		info, err := fd.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if info.Size() > end {
+			if err := fd.Truncate(end); err != nil {
+				return 0, err
+			}
+		}
+		c.file, c.prev = fd.Name(), prev
+	}
+
+	// one line per record, or the file could not be verified
+	line := bytes.ReplaceAll(bytes.TrimSuffix(p, []byte("\n")), []byte("\n"), []byte(`\n`))
+	mac := auditMAC(c.key, c.prev, line)
+	buf := make([]byte, 0, len(line)+len(mac)+2)
+	buf = append(append(append(append(buf, line...), '|'), mac...), '\n')
+	if _, err := fd.Write(buf); err != nil {
+		return 0, err
+	}
+	c.prev = mac
+	return len(p), nil
+}
+
+func (c *auditChainHandler) Flush() error {
+	return c.h.Flush()
+}
+
+func (c *auditChainHandler) Close() error {
+	return c.h.Close()
+}
+
+// auditMAC returns the hex HMAC of a line chained to prev
+func auditMAC(key []byte, prev []byte, line []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(prev)
+	m.Write(line)
+	sum := m.Sum(nil)
+	mac := make([]byte, hex.EncodedLen(len(sum)))
+	hex.Encode(mac, sum)
+	return mac
+}
+
+// how much of an audit file lastAuditMAC reads at a time
+const auditReadChunk = 4096
+
+// lastAuditMAC returns the mac ending the last complete line of an audit
+// file, nil if there is none, and the offset following that line. The file
+// is read backwards from its end. Bytes after the last '\n' are a line cut
+// short by a crash, they are not part of the chain.
+func lastAuditMAC(fileName string) (mac []byte, end int64, err error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// buf holds the file from pos to its end
+	var buf []byte
+	pos := info.Size()
+	end = -1
+	for {
+		if end < 0 {
+			if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+				end = pos + int64(i) + 1
+			}
+		}
+		if end >= 0 {
+			line := buf[:end-pos-1]
+			if i := bytes.LastIndexByte(line, '\n'); i >= 0 || pos == 0 {
+				line = line[i+1:]
+				j := bytes.LastIndexByte(line, '|')
+				if j < 0 {
+					return nil, 0, fmt.Errorf("galog: %s: last line has no audit mac", fileName)
+				}
+				return line[j+1:], end, nil
+			}
+		}
+		if pos == 0 {
+			return nil, 0, nil
+		}
+
+		n := int64(auditReadChunk)
+		if n > pos {
+			n = pos
+		}
+		pos -= n
+		chunk := make([]byte, n, n+int64(len(buf)))
+		if _, err := f.ReadAt(chunk, pos); err != nil {
+			return nil, 0, err
+		}
+		buf = append(chunk, buf...)
+	}
+}
+
+// VerifyGMAudit checks the HMAC chain of a gmaudit file with key, and
+// returns the number of lines verified. A modified, inserted or deleted
+// line gives an error wrapping ErrAuditTampered, with the number of the
+// first line not matching. Lines removed at the end of a file leave a valid
+// chain, compare the count with what the collector received to detect it.
+func VerifyGMAudit(fileName string, key []byte) (int, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var prev []byte
+	n := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		n++
+		b := scanner.Bytes()
+		i := bytes.LastIndexByte(b, '|')
+		if i < 0 {
+			return n - 1, fmt.Errorf("%w: %s line %d has no mac", ErrAuditTampered, fileName, n)
+		}
+		mac := auditMAC(key, prev, b[:i])
+		if !hmac.Equal(mac, b[i+1:]) {
+			return n - 1, fmt.Errorf("%w: %s line %d", ErrAuditTampered, fileName, n)
+		}
+		prev = mac
+	}
+	if err := scanner.Err(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,80 @@
+package galog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditChainResumesAfterCrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := []byte("key")
+	base := filepath.Join(dir, "gmaudit")
+	fileName := base + "." + time.Now().Format("2006-01-02")
+
+	newChain := func() *auditChainHandler {
+		h, err := newTimeRotatingFileHandler(base, WhenDay, 1, 0666, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &auditChainHandler{h: h, key: key}
+	}
+
+	c := newChain()
+	// lines longer than what lastAuditMAC reads at a time
+	long := strings.Repeat("x", auditReadChunk)
+	for _, line := range []string{"first\n", long + "\n", "third\n"} {
+		if _, err := c.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+
+	// a crash in the middle of a line
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("torn|" + long[:100])
+	f.Close()
+
+	mac, end, err := lastAuditMAC(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(fileName)
+	lines := strings.Split(string(b[:end]), "\n")
+	if last := lines[len(lines)-2]; !strings.HasPrefix(last, "third|") || !strings.HasSuffix(last, "|"+string(mac)) {
+		t.Errorf("mac %s, want the one of %q", mac, last)
+	}
+
+	c = newChain()
+	if _, err := c.Write([]byte("fourth\n")); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if n, err := VerifyGMAudit(fileName, key); n != 4 || err != nil {
+		t.Errorf("verified %d lines, %v, want 4", n, err)
+	}
+}
+
+func TestLastAuditMACEmpty(t *testing.T) {
+	f, err := ioutil.TempFile("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("no line end")
+	f.Close()
+
+	if mac, end, err := lastAuditMAC(f.Name()); mac != nil || end != 0 || err != nil {
+		t.Errorf("got %q, %d, %v, want no mac", mac, end, err)
+	}
+}
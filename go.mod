@@ -1,3 +1,3 @@
 module github.com/ybm2dyd/galog
 
-go 1.15
+go 1.21
@@ -1,7 +1,12 @@
 package galog
 
 import (
+	"errors"
 	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 //Handler writes logs to somewhere
@@ -10,6 +15,27 @@ type Handler interface {
 	Close() error
 }
 
+// EntryHandler is implemented by handlers which need the entry itself and
+// not only its formatted bytes, e.g. to filter on level or to format it
+// their own way. The logger calls WriteEntry instead of Write for them.
+type EntryHandler interface {
+	Handler
+	WriteEntry(entry *Entry, p []byte) (n int, err error)
+}
+
+func writeEntry(h Handler, entry *Entry, p []byte) (n int, err error) {
+	if eh, ok := h.(EntryHandler); ok {
+		return eh.WriteEntry(entry, p)
+	}
+	return h.Write(p)
+}
+
+// Flusher is implemented by handlers that buffer writes, Flush commits
+// anything pending to the underlying storage.
+type Flusher interface {
+	Flush() error
+}
+
 //StreamHandler writes logs to a specified io Writer, maybe stdout, stderr, etc...
 type StreamHandler struct {
 	w io.Writer
@@ -51,3 +77,300 @@ func (h *NullHandler) Write(b []byte) (n int, err error) {
 func (h *NullHandler) Close() error {
 	return nil
 }
+
+// MultiError gathers the errors of several handlers.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e MultiError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Destination is one output of a MultiHandler.
+type Destination struct {
+	// Handler to write to
+	Handler Handler
+
+	// Level is the least severe level written to Handler, entries below it
+	// are skipped. The zero value, PanicLevel, writes every level unless
+	// LevelSet is set.
+	Level Level
+
+	// LevelSet applies Level even when it is PanicLevel, to write only the
+	// panics to Handler.
+	LevelSet bool
+
+	// Formatter used for Handler, nil keeps the logger's formatting.
+	Formatter Formatter
+
+	// ReportCaller makes the entries carry their caller for Formatter and
+	// Handler, even when the logger does not report it.
+	ReportCaller bool
+
+	// Sync writes Handler on the goroutine of the caller and returns its
+	// errors, for handlers which do not block such as files. Other
+	// destinations are written by a goroutine of their own, so that a slow
+	// or hung one does not hold up the others.
+	Sync bool
+
+	// QueueSize is the number of entries waiting for an asynchronous
+	// destination, 1024 by default. Entries are dropped with ErrQueueFull
+	// when it is full.
+	QueueSize int
+}
+
+// default of Destination.QueueSize
+const defaultDestinationQueueSize = 1024
+
+// how long MultiHandler.Flush waits for an asynchronous destination
+const destinationFlushTimeout = 5 * time.Second
+
+// MultiHandler writes every entry to several destinations, each with its
+// own level and formatter, e.g. Info+ to a file and Error+ to stderr.
+//
+// A failing destination does not prevent the others from being written,
+// errors of all destinations are returned together as a MultiError. Errors
+// of the asynchronous destinations go to the ErrorHandler of the logger.
+type MultiHandler struct {
+	dests   []*destination
+	caller  bool
+	mutex   sync.RWMutex
+	closed  bool
+	running sync.WaitGroup
+}
+
+// destination is a Destination and its queue, nil if Sync
+type destination struct {
+	Destination
+	queue chan destinationItem
+}
+
+// destinationItem is an entry waiting for an asynchronous destination, or
+// a flush request if flushed is set
+type destinationItem struct {
+	entry   *Entry
+	p       []byte
+	flushed chan error
+}
+
+// NewMultiHandler return MultiHandler
+func NewMultiHandler(dests ...Destination) (*MultiHandler, error) {
+	h := new(MultiHandler)
+
+	for _, d := range dests {
+		h.addLocked(d)
+	}
+
+	return h, nil
+}
+
+// add appends a destination to the handler in use, for AddOutput
+func (h *MultiHandler) add(d Destination) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return os.ErrClosed
+	}
+	h.addLocked(d)
+	return nil
+}
+
+func (h *MultiHandler) addLocked(d Destination) {
+	dest := &destination{Destination: d}
+	if !d.Sync {
+		size := d.QueueSize
+		if size <= 0 {
+			size = defaultDestinationQueueSize
+		}
+		dest.queue = make(chan destinationItem, size)
+		h.running.Add(1)
+		go h.run(dest)
+	}
+	h.caller = h.caller || d.ReportCaller
+	h.dests = append(h.dests, dest)
+}
+
+func (h *MultiHandler) run(d *destination) {
+	defer h.running.Done()
+	for item := range d.queue {
+		if item.flushed != nil {
+			item.flushed <- flush(d.Handler)
+			continue
+		}
+		var err error
+		if item.entry == nil {
+			_, err = d.Handler.Write(item.p)
+		} else {
+			err = d.write(item.entry, item.p)
+		}
+		if err == nil {
+			continue
+		}
+		if item.entry != nil && item.entry.Logger != nil {
+			item.entry.Logger.handleError(err)
+		} else {
+			defaultErrorHandler("Failed to write to log")(err)
+		}
+	}
+}
+
+func (h *MultiHandler) reportCaller() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.caller
+}
+
+// Write p to every destination, regardless of their level
+func (h *MultiHandler) Write(p []byte) (n int, err error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var errs MultiError
+	for _, d := range h.dests {
+		if d.queue == nil {
+			_, err = d.Handler.Write(p)
+		} else {
+			err = h.enqueue(d, destinationItem{p: append([]byte(nil), p...)})
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(p), errs.err()
+}
+
+// WriteEntry writes the entry to the destinations whose level it meets,
+// formatted by their own formatter.
+func (h *MultiHandler) WriteEntry(entry *Entry, p []byte) (n int, err error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var errs MultiError
+	var queued *Entry
+	for _, d := range h.dests {
+		if (d.LevelSet || d.Level != PanicLevel) && entry.Level > d.Level {
+			continue
+		}
+		if d.queue == nil {
+			err = d.write(entry, p)
+		} else {
+			if queued == nil {
+				// p is the pooled buffer of the logger, and the entry
+				// may be reused once this returns
+				queued = entry.dup()
+				p = append([]byte(nil), p...)
+			}
+			err = h.enqueue(d, destinationItem{entry: queued, p: p})
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(p), errs.err()
+}
+
+// enqueue queues an item for an asynchronous destination, the read lock is
+// held
+func (h *MultiHandler) enqueue(d *destination, item destinationItem) error {
+	if h.closed {
+		return os.ErrClosed
+	}
+	select {
+	case d.queue <- item:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (d *destination) write(entry *Entry, p []byte) error {
+	if d.Formatter == nil {
+		_, err := writeEntry(d.Handler, entry, p)
+		return err
+	}
+
+	buffer := getBuffer()
+	defer putBuffer(buffer)
+
+	serialized, err := format(d.Formatter, entry, buffer)
+	if err != nil {
+		return err
+	}
+	_, err = writeEntry(d.Handler, entry, serialized)
+	return err
+}
+
+func flush(h Handler) error {
+	if f, ok := h.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Flush every destination that buffers writes, after the entries queued
+// for it. A destination not flushed within 5 seconds gives an error.
+func (h *MultiHandler) Flush() error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var errs MultiError
+	for _, d := range h.dests {
+		if d.queue == nil {
+			if err := flush(d.Handler); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if h.closed {
+			continue
+		}
+		flushed := make(chan error, 1)
+		timer := time.NewTimer(destinationFlushTimeout)
+		select {
+		case d.queue <- destinationItem{flushed: flushed}:
+			select {
+			case err := <-flushed:
+				if err != nil {
+					errs = append(errs, err)
+				}
+			case <-timer.C:
+				errs = append(errs, errors.New("galog: destination flush timed out"))
+			}
+		case <-timer.C:
+			errs = append(errs, errors.New("galog: destination flush timed out"))
+		}
+		timer.Stop()
+	}
+	return errs.err()
+}
+
+// Close waits for the queued entries to be written, then closes every
+// destination
+func (h *MultiHandler) Close() error {
+	h.mutex.Lock()
+	if !h.closed {
+		h.closed = true
+		for _, d := range h.dests {
+			if d.queue != nil {
+				close(d.queue)
+			}
+		}
+	}
+	h.mutex.Unlock()
+	h.running.Wait()
+
+	var errs MultiError
+	for _, d := range h.dests {
+		if err := d.Handler.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.err()
+}
@@ -0,0 +1,132 @@
+package galog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingHandler blocks every write until release is closed
+type blockingHandler struct {
+	release chan struct{}
+}
+
+func (h blockingHandler) Write(p []byte) (int, error) {
+	<-h.release
+	return len(p), nil
+}
+
+func (h blockingHandler) Close() error { return nil }
+
+func TestMultiHandlerHungDestination(t *testing.T) {
+	hung := blockingHandler{release: make(chan struct{})}
+	out := new(lockedBuffer)
+	h, _ := NewMultiHandler(
+		Destination{Handler: hung, QueueSize: 1},
+		Destination{Handler: nopCloser{out}},
+	)
+	logger := New()
+	logger.SetOutput(h)
+	// the hung destination drops what its queue can not hold
+	logger.ErrorHandler = func(error) {}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			logger.Info("line")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging blocked on a hung destination")
+	}
+
+	close(hung.release)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "line"); n != 10 {
+		t.Fatalf("healthy destination got %d lines, want 10", n)
+	}
+}
+
+func TestMultiHandlerLevels(t *testing.T) {
+	var all, errs, panics bytes.Buffer
+	h, _ := NewMultiHandler(
+		Destination{Handler: nopCloser{&all}, Sync: true},
+		Destination{Handler: nopCloser{&errs}, Level: ErrorLevel, Sync: true},
+		Destination{Handler: nopCloser{&panics}, Level: PanicLevel, LevelSet: true, Sync: true},
+	)
+	logger := New()
+	logger.SetLevel(TraceLevel)
+	logger.SetOutput(h)
+	logger.LogOnly = true
+	logger.Debug("debug")
+	logger.Error("error")
+	logger.Panic("panic")
+
+	if !strings.Contains(all.String(), "debug") || !strings.Contains(all.String(), "error") {
+		t.Errorf("zero level destination got %q, want every level", all.String())
+	}
+	if strings.Contains(errs.String(), "debug") || !strings.Contains(errs.String(), "error") {
+		t.Errorf("error destination got %q", errs.String())
+	}
+	if strings.Contains(panics.String(), "error") || !strings.Contains(panics.String(), "panic") {
+		t.Errorf("panic destination got %q", panics.String())
+	}
+}
+
+func TestReportCaller(t *testing.T) {
+	var out bytes.Buffer
+	logger := New()
+	logger.SetFormatter(&TextFormatter{DisableColors: true, DisableTimestamp: true})
+	logger.SetOutput(nopCloser{&out})
+	logger.Info("with caller\n")
+	// frames of galog are skipped, this test included
+	if !strings.Contains(out.String(), "testing.tRunner") {
+		t.Errorf("got %q, want the caller", out.String())
+	}
+
+	out.Reset()
+	logger.ReportCaller = false
+	logger.Info("without caller\n")
+	if got := out.String(); got != "INFO  without caller\n" {
+		t.Errorf("got %q, want no caller", got)
+	}
+
+	// a destination asking for the caller gets it
+	var dest bytes.Buffer
+	h, _ := NewMultiHandler(Destination{
+		Handler:      nopCloser{&dest},
+		Formatter:    &JSONFormatter{},
+		ReportCaller: true,
+		Sync:         true,
+	})
+	logger.SetOutput(h)
+	logger.Info("to destination")
+	if !strings.Contains(dest.String(), `"caller"`) {
+		t.Errorf("got %q, want the caller", dest.String())
+	}
+}
+
+// levelFormatter only implements the historical Formatter interface
+type levelFormatter struct{}
+
+func (levelFormatter) Format(level Level, buffer *bytes.Buffer, msg string) ([]byte, error) {
+	buffer.WriteString(level.String() + ":" + msg)
+	return buffer.Bytes(), nil
+}
+
+func TestLegacyFormatter(t *testing.T) {
+	var out bytes.Buffer
+	logger := New()
+	logger.SetFormatter(levelFormatter{})
+	logger.SetOutput(nopCloser{&out})
+	logger.Warn("careful")
+	if got := out.String(); got != "warn:careful" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,106 @@
+package galog
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrHookQueueFull is returned by AsyncHook.Fire when the entry was dropped
+// because the queue is full.
+var ErrHookQueueFull = errors.New("galog: hook queue is full")
+
+// Hook is fired by the logger for every entry logged at one of its Levels,
+// e.g. to send errors to an alerting system or to count warnings.
+type Hook interface {
+	Levels() []Level
+	Fire(*Entry) error
+}
+
+// LevelHooks holds the hooks of a logger, indexed by level.
+type LevelHooks map[Level][]Hook
+
+// Add a hook to every level it is interested in.
+func (hooks LevelHooks) Add(hook Hook) {
+	for _, level := range hook.Levels() {
+		hooks[level] = append(hooks[level], hook)
+	}
+}
+
+// Fire calls every hook registered for the entry's level. Each hook gets
+// its own copy of the entry, so a hook modifying it does not affect the
+// others nor what is written.
+func (hooks LevelHooks) Fire(entry *Entry) []error {
+	var errs []error
+	for _, hook := range hooks[entry.Level] {
+		if err := hook.Fire(entry.dup()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// AsyncHook runs a hook on its own goroutine, so that slow side effects
+// such as network calls do not hold up the caller. Entries are dropped when
+// the queue is full, errors from the wrapped hook are reported to the
+// ErrorHandler of the logger the entry came from.
+type AsyncHook struct {
+	hook   Hook
+	queue  chan *Entry
+	done   chan struct{}
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewAsyncHook return AsyncHook
+func NewAsyncHook(hook Hook, queueSize int) *AsyncHook {
+	h := new(AsyncHook)
+
+	h.hook = hook
+	h.queue = make(chan *Entry, queueSize)
+	h.done = make(chan struct{})
+
+	go h.run()
+
+	return h
+}
+
+func (h *AsyncHook) run() {
+	defer close(h.done)
+	for entry := range h.queue {
+		if err := h.hook.Fire(entry); err != nil && entry.Logger != nil {
+			entry.Logger.handleError(err)
+		}
+	}
+}
+
+// Levels of the wrapped hook
+func (h *AsyncHook) Levels() []Level {
+	return h.hook.Levels()
+}
+
+// Fire queues the entry, it never blocks.
+func (h *AsyncHook) Fire(entry *Entry) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.closed {
+		return nil
+	}
+	select {
+	case h.queue <- entry:
+		return nil
+	default:
+		return ErrHookQueueFull
+	}
+}
+
+// Close stops accepting entries and waits for the queued ones to be fired.
+func (h *AsyncHook) Close() error {
+	h.mutex.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.queue)
+	}
+	h.mutex.Unlock()
+	<-h.done
+	return nil
+}
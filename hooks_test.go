@@ -0,0 +1,96 @@
+package galog
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type recordHook struct {
+	mutex   sync.Mutex
+	entries []*Entry
+	written func() bool
+	missed  int
+}
+
+func (h *recordHook) Levels() []Level {
+	return []Level{PanicLevel, FatalLevel, ErrorLevel, WarnLevel, InfoLevel, DebugLevel, TraceLevel}
+}
+
+func (h *recordHook) Fire(entry *Entry) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.entries = append(h.entries, entry)
+	if h.written != nil && !h.written() {
+		h.missed++
+	}
+	return nil
+}
+
+type failingHandler struct{}
+
+func (failingHandler) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+func (failingHandler) Close() error                { return nil }
+
+func TestAfterHookFiredOnceWritten(t *testing.T) {
+	var out bytes.Buffer
+	logger := New()
+	logger.SetOutput(nopCloser{&out})
+	hook := &recordHook{written: func() bool { return out.Len() > 0 }}
+	logger.AddAfterHook(hook)
+
+	logger.Info("hello")
+	if len(hook.entries) != 1 || hook.missed != 0 {
+		t.Fatalf("after hook fired %d times, %d before the write", len(hook.entries), hook.missed)
+	}
+
+	logger.SetOutput(failingHandler{})
+	logger.Info("lost")
+	if len(hook.entries) != 1 {
+		t.Fatalf("after hook fired for a failed write")
+	}
+}
+
+func TestAddHookWhileLoggingWithoutLock(t *testing.T) {
+	logger := New()
+	logger.SetOutput(nopCloser{new(lockedBuffer)})
+	// as the event loggers do
+	logger.SetNoLock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Info("x")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				logger.AddHook(new(recordHook))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+type nopCloser struct {
+	w interface{ Write([]byte) (int, error) }
+}
+
+func (n nopCloser) Write(p []byte) (int, error) { return n.w.Write(p) }
+func (n nopCloser) Close() error                { return nil }
+
+type lockedBuffer struct {
+	mutex sync.Mutex
+	bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.Buffer.Write(p)
+}
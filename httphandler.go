@@ -0,0 +1,358 @@
+package galog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HTTPEncoding selects how HTTPHandler puts records in a request body
+type HTTPEncoding int
+
+const (
+	// NDJSON sends records one per line, as they were formatted
+	NDJSON HTTPEncoding = iota
+	// JSONArray sends records as the elements of a JSON array, it requires
+	// each record to be a JSON document, e.g. formatted by JSONFormatter.
+	JSONArray
+)
+
+// HTTPOptions configures an HTTPHandler, zero values use the defaults.
+type HTTPOptions struct {
+	BatchOptions
+	RetryOptions
+
+	// Encoding of the request body, NDJSON by default
+	Encoding HTTPEncoding
+
+	// Gzip compresses request bodies
+	Gzip bool
+
+	// Header is added to every request, e.g. for authentication
+	Header http.Header
+
+	// Client used for requests, http.DefaultClient by default
+	Client *http.Client
+
+	// DeadLetter is a file where records are appended, one per line, when
+	// they could not be delivered after all retries.
+	DeadLetter string
+
+	// ErrorHandler receives delivery errors, they are printed on os.Stderr
+	// by default.
+	ErrorHandler func(error)
+}
+
+// httpStatusError is returned for non 2xx responses
+type httpStatusError struct {
+	StatusCode int
+	Body       string
+	retryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// httpTransportError is returned when a request could not be sent or its
+// response not be read
+type httpTransportError struct {
+	err error
+}
+
+func (e *httpTransportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *httpTransportError) Unwrap() error {
+	return e.err
+}
+
+// retryable reports whether a request failing with err is worth retrying:
+// network errors, 429 and 5xx are, other statuses and errors building the
+// request are not.
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case *httpStatusError:
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+	case *httpTransportError:
+		return true
+	}
+	return false
+}
+
+// httpSender posts request bodies, retrying with backoff. It is shared by
+// the handlers talking to HTTP collectors.
+type httpSender struct {
+	url    string
+	client *http.Client
+	header http.Header
+	gzip   bool
+	retry  RetryOptions
+	// closed when the handler is closed, to stop waiting between retries
+	stop     chan struct{}
+	stopOnce sync.Once
+	// retryable is consulted before retrying, nil means retryable()
+	retryable func(error) bool
+	// fullResponse reads response bodies whole instead of their first
+	// MiB, for the bulk API answering with an item per document
+	fullResponse bool
+}
+
+// how much of a response body is read, see httpSender.fullResponse
+const maxHTTPResponse = 1 << 20
+
+func newHTTPSender(url string, client *http.Client, header http.Header, gzip bool, retry RetryOptions) *httpSender {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	retry.setDefaults()
+	return &httpSender{
+		url:    url,
+		client: client,
+		header: header,
+		gzip:   gzip,
+		retry:  retry,
+		stop:   make(chan struct{}),
+	}
+}
+
+// post sends body until it succeeds, fails with an error not worth
+// retrying, or retries run out. It returns the body of the response.
+func (s *httpSender) post(body []byte, contentType string) ([]byte, error) {
+	if s.gzip {
+		var err error
+		if body, err = gzipBytes(body); err != nil {
+			return nil, err
+		}
+	}
+
+	isRetryable := s.retryable
+	if isRetryable == nil {
+		isRetryable = retryable
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := s.do(body, contentType)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= s.retry.MaxRetries || !isRetryable(err) {
+			return nil, err
+		}
+
+		wait := s.retry.backoff(attempt)
+		if e, ok := err.(*httpStatusError); ok && e.retryAfter > 0 {
+			// a server asking for an hour would hold the batch as long
+			wait = e.retryAfter
+			if wait > s.retry.MaxBackoff {
+				wait = s.retry.MaxBackoff
+			}
+		}
+		select {
+		case <-time.After(wait):
+		case <-s.stop:
+			return nil, err
+		}
+	}
+}
+
+func (s *httpSender) do(body []byte, contentType string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, &httpTransportError{err}
+	}
+	defer resp.Body.Close()
+
+	var r io.Reader = resp.Body
+	if !s.fullResponse {
+		r = io.LimitReader(resp.Body, maxHTTPResponse)
+	}
+	respBody, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, &httpTransportError{err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &httpStatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(bytes.TrimSpace(respBody)),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return respBody, nil
+}
+
+func (s *httpSender) close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// parseRetryAfter accepts both forms of the header, seconds or a date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func gzipBytes(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(p); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// HTTPHandler ships records to a collector endpoint in POST requests.
+//
+// Records are queued in memory and sent in batches from a background
+// goroutine, see BatchOptions. Failed requests are retried with exponential
+// backoff on network errors, 429 and 5xx; records that still could not be
+// delivered are appended to the DeadLetter file if one is set.
+type HTTPHandler struct {
+	sender       *httpSender
+	batcher      *batcher
+	encoding     HTTPEncoding
+	deadLetter   *deadLetter
+	errorHandler func(error)
+}
+
+// NewHTTPHandler return HTTPHandler posting to url
+func NewHTTPHandler(url string, opts HTTPOptions) (*HTTPHandler, error) {
+	h := new(HTTPHandler)
+
+	if opts.Encoding != NDJSON && opts.Encoding != JSONArray {
+		return nil, fmt.Errorf("invalid http encoding: %d", opts.Encoding)
+	}
+	opts.BatchOptions.setDefaults()
+
+	h.sender = newHTTPSender(url, opts.Client, opts.Header, opts.Gzip, opts.RetryOptions)
+	h.encoding = opts.Encoding
+	h.deadLetter = newDeadLetter(opts.DeadLetter)
+	h.errorHandler = opts.ErrorHandler
+	if h.errorHandler == nil {
+		h.errorHandler = defaultErrorHandler("Failed to deliver logs")
+	}
+	h.batcher = newBatcher(opts.BatchOptions, h.deliver)
+	h.batcher.drop = h.drop
+
+	return h, nil
+}
+
+// Write queues a copy of p, it does not wait for it to be sent.
+func (h *HTTPHandler) Write(p []byte) (n int, err error) {
+	record := make([]byte, len(p))
+	copy(record, p)
+	if err := h.batcher.add(record, len(record)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (h *HTTPHandler) deliver(items []interface{}) {
+	records := make([][]byte, len(items))
+	for i, item := range items {
+		records[i] = item.([]byte)
+	}
+	if err := h.send(records); err != nil {
+		h.errorHandler(err)
+		if err := h.deadLetter.write(records); err != nil {
+			h.errorHandler(err)
+		}
+	}
+}
+
+// drop reports the records left when Close timed out
+func (h *HTTPHandler) drop(items []interface{}) {
+	records := make([][]byte, len(items))
+	for i, item := range items {
+		records[i] = item.([]byte)
+	}
+	h.errorHandler(fmt.Errorf("%d records dropped, handler closed", len(records)))
+	if err := h.deadLetter.write(records); err != nil {
+		h.errorHandler(err)
+	}
+}
+
+// send posts one batch of records, retrying as configured.
+func (h *HTTPHandler) send(records [][]byte) error {
+	var body bytes.Buffer
+	contentType := "application/x-ndjson"
+
+	switch h.encoding {
+	case JSONArray:
+		contentType = "application/json"
+		body.WriteByte('[')
+		for i, r := range records {
+			if i > 0 {
+				body.WriteByte(',')
+			}
+			body.Write(bytes.TrimSpace(r))
+		}
+		body.WriteByte(']')
+	default:
+		for _, r := range records {
+			body.Write(r)
+			if len(r) == 0 || r[len(r)-1] != '\n' {
+				body.WriteByte('\n')
+			}
+		}
+	}
+
+	_, err := h.sender.post(body.Bytes(), contentType)
+	return err
+}
+
+// WriteBatch sends records right away, bypassing the queue, and returns
+// once they are delivered or retries ran out. It makes HTTPHandler a
+// BatchWriter, to be used as the output of a SpoolHandler.
+func (h *HTTPHandler) WriteBatch(records [][]byte) error {
+	return h.send(records)
+}
+
+// cancelBatch stops retrying, for SpoolHandler.Close
+func (h *HTTPHandler) cancelBatch() {
+	h.sender.close()
+}
+
+// Flush sends the queued records and waits for the requests to complete
+func (h *HTTPHandler) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close sends the queued records, retrying as configured, and stops the
+// handler. It waits up to CloseTimeout, then stops retrying; records still
+// not delivered go to the dead letter file.
+func (h *HTTPHandler) Close() error {
+	h.batcher.close()
+	h.sender.close()
+	return nil
+}
@@ -0,0 +1,248 @@
+package galog
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector records the bodies posted to it, answering with the statuses
+// of replies in turn and 200 once they run out
+type collector struct {
+	mutex   sync.Mutex
+	bodies  []string
+	headers []http.Header
+	replies []int
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	b, _ := ioutil.ReadAll(body)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.bodies = append(c.bodies, string(b))
+	c.headers = append(c.headers, r.Header)
+	if len(c.replies) > 0 {
+		status := c.replies[0]
+		c.replies = c.replies[1:]
+		w.WriteHeader(status)
+	}
+}
+
+func (c *collector) received() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string(nil), c.bodies...)
+}
+
+// fastRetry keeps retries short in tests
+var fastRetry = RetryOptions{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestHTTPHandlerBatches(t *testing.T) {
+	c := new(collector)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	h, err := NewHTTPHandler(srv.URL, HTTPOptions{
+		BatchOptions: BatchOptions{BatchSize: 2, FlushInterval: time.Hour},
+		Gzip:         true,
+		Header:       http.Header{"Authorization": {"Bearer token"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"a\n", "b", "c\n"} {
+		if _, err := h.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the third record is only sent by Close
+	h.Close()
+
+	bodies := c.received()
+	if len(bodies) != 2 || bodies[0] != "a\nb\n" || bodies[1] != "c\n" {
+		t.Fatalf("bodies %q, want two batches", bodies)
+	}
+	header := c.headers[0]
+	if header.Get("Content-Type") != "application/x-ndjson" || header.Get("Authorization") != "Bearer token" {
+		t.Errorf("headers %v", header)
+	}
+	if _, err := h.Write([]byte("late")); err != os.ErrClosed {
+		t.Errorf("write after Close returned %v, want os.ErrClosed", err)
+	}
+}
+
+func TestHTTPHandlerJSONArray(t *testing.T) {
+	c := new(collector)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	h, _ := NewHTTPHandler(srv.URL, HTTPOptions{Encoding: JSONArray})
+	h.Write([]byte(`{"a":1}` + "\n"))
+	h.Write([]byte(`{"b":2}`))
+	h.Flush()
+	defer h.Close()
+
+	if bodies := c.received(); len(bodies) != 1 || bodies[0] != `[{"a":1},{"b":2}]` {
+		t.Fatalf("bodies %q", bodies)
+	}
+}
+
+func TestHTTPHandlerRetry(t *testing.T) {
+	c := &collector{replies: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	var errs []error
+	h, _ := NewHTTPHandler(srv.URL, HTTPOptions{
+		RetryOptions: fastRetry,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	h.Write([]byte("retried\n"))
+	h.Close()
+
+	if bodies := c.received(); len(bodies) != 3 {
+		t.Fatalf("%d attempts, want 3", len(bodies))
+	}
+	if len(errs) != 0 {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestHTTPHandlerDeadLetter(t *testing.T) {
+	c := &collector{replies: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetter := filepath.Join(dir, "dead")
+
+	var errs []error
+	h, _ := NewHTTPHandler(srv.URL, HTTPOptions{
+		RetryOptions: fastRetry,
+		DeadLetter:   deadLetter,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	h.Write([]byte("rejected"))
+	h.Close()
+
+	// 400 is not retried
+	if bodies := c.received(); len(bodies) != 1 {
+		t.Fatalf("%d attempts, want 1", len(bodies))
+	}
+	if len(errs) != 1 {
+		t.Fatalf("errors %v, want one", errs)
+	}
+	b, err := ioutil.ReadFile(deadLetter)
+	if err != nil || string(b) != "rejected\n" {
+		t.Fatalf("dead letter %q, %v", b, err)
+	}
+}
+
+func TestHTTPHandlerCloseTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetter := filepath.Join(dir, "dead")
+
+	h, _ := NewHTTPHandler(srv.URL, HTTPOptions{
+		BatchOptions: BatchOptions{BatchSize: 1, CloseTimeout: 50 * time.Millisecond},
+		RetryOptions: RetryOptions{MaxRetries: 100, MinBackoff: time.Minute, MaxBackoff: time.Minute},
+		DeadLetter:   deadLetter,
+		ErrorHandler: func(error) {},
+	})
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		h.Write([]byte(line))
+	}
+
+	start := time.Now()
+	h.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Close took %v", d)
+	}
+	// the batch being retried fails and the others are dropped, all of
+	// them end in the dead letter file
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, _ := ioutil.ReadFile(deadLetter)
+		if len(b) == len("a\nb\nc\n") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dead letter %q", b)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHTTPRetryAfterCapped(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts++; attempts == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	s := newHTTPSender(srv.URL, nil, nil, false, fastRetry)
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.post([]byte("a"), "text/plain")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		s.close()
+		t.Fatal("waited for Retry-After over MaxBackoff")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&httpStatusError{StatusCode: 500}, true},
+		{&httpStatusError{StatusCode: 429}, true},
+		{&httpStatusError{StatusCode: 404}, false},
+		{&httpTransportError{errors.New("connection refused")}, true},
+		{errors.New("invalid url"), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
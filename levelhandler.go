@@ -0,0 +1,119 @@
+package galog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// levelState is the body of GET responses of LevelHandler
+type levelState struct {
+	Level   Level            `json:"level"`
+	Loggers map[string]Level `json:"loggers"`
+}
+
+// levelRequest is the body of PUT requests to LevelHandler
+type levelRequest struct {
+	// Name of the logger, empty for the root logger
+	Name string `json:"name"`
+	// Level to set
+	Level *Level `json:"level"`
+	// Duration after which the previous level is put back, e.g. "10m".
+	// Empty keeps the level until changed again.
+	Duration string `json:"duration"`
+}
+
+// LevelHandler exposes the levels of a logger tree over HTTP, so that the
+// verbosity of a live server can be changed without restarting it.
+//
+//	GET    returns {"level":"info","loggers":{"battle":"debug"}}
+//	GET    ?name=battle.skill returns {"name":"battle.skill","level":"debug"}
+//	PUT    {"name":"battle","level":"debug","duration":"10m"} sets a level
+//	DELETE ?name=battle removes the level set for a name
+//
+// It is not mounted anywhere by galog, it is up to the application to serve
+// it, preferably on an admin only address.
+type LevelHandler struct {
+	logger *Logger
+}
+
+// NewLevelHandler return LevelHandler for the tree the logger belongs to
+func NewLevelHandler(logger *Logger) *LevelHandler {
+	h := new(LevelHandler)
+
+	h.logger = logger.root()
+
+	return h
+}
+
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r)
+	case http.MethodPut:
+		h.put(w, r)
+	case http.MethodDelete:
+		h.delete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *LevelHandler) get(w http.ResponseWriter, r *http.Request) {
+	if name := r.URL.Query().Get("name"); name != "" {
+		writeJSON(w, map[string]interface{}{
+			"name":  name,
+			"level": h.logger.Named(name).GetLevel(),
+		})
+		return
+	}
+	h.writeState(w)
+}
+
+func (h *LevelHandler) put(w http.ResponseWriter, r *http.Request) {
+	var req levelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid body, %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Level == nil {
+		http.Error(w, "level is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Duration == "" {
+		h.logger.SetLevelFor(req.Name, *req.Level)
+	} else {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+		h.logger.SetLevelForDuration(req.Name, *req.Level, d)
+	}
+	h.writeState(w)
+}
+
+func (h *LevelHandler) delete(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	h.logger.ClearLevelFor(name)
+	h.writeState(w)
+}
+
+func (h *LevelHandler) writeState(w http.ResponseWriter) {
+	writeJSON(w, levelState{
+		Level:   h.logger.GetLevel(),
+		Loggers: h.logger.LevelOverrides(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,91 @@
+package galog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveLevel(h http.Handler, method string, target string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestLevelHandlerGet(t *testing.T) {
+	root := New()
+	root.SetLevelFor("battle", DebugLevel)
+	h := NewLevelHandler(root.Named("battle"))
+
+	w := serveLevel(h, http.MethodGet, "/", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"level":"info","loggers":{"battle":"debug"}}` {
+		t.Errorf("GET %d %s", w.Code, w.Body.String())
+	}
+	w = serveLevel(h, http.MethodGet, "/?name=battle.skill", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"level":"debug","name":"battle.skill"}` {
+		t.Errorf("GET ?name %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLevelHandlerPut(t *testing.T) {
+	root := New()
+	h := NewLevelHandler(root)
+
+	w := serveLevel(h, http.MethodPut, "/", `{"name":"battle","level":"debug"}`)
+	if w.Code != http.StatusOK || !root.Named("battle").IsLevelEnabled(DebugLevel) {
+		t.Fatalf("PUT %d %s", w.Code, w.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"name":"battle","level":"loud"}`,
+		`{"name":"battle"}`,
+		`{"name":"battle","level":"trace","duration":"soon"}`,
+	} {
+		w := serveLevel(h, http.MethodPut, "/", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: %d, want 400", body, w.Code)
+		}
+	}
+	if level := root.LevelOverrides()["battle"]; level != DebugLevel {
+		t.Errorf("level %v after invalid requests", level)
+	}
+}
+
+func TestLevelHandlerPutDuration(t *testing.T) {
+	root := New()
+	root.SetLevelFor("battle", WarnLevel)
+	h := NewLevelHandler(root)
+
+	w := serveLevel(h, http.MethodPut, "/", `{"name":"battle","level":"debug","duration":"20ms"}`)
+	if w.Code != http.StatusOK || root.LevelOverrides()["battle"] != DebugLevel {
+		t.Fatalf("PUT %d %s", w.Code, w.Body.String())
+	}
+
+	// the level set before is put back
+	deadline := time.Now().Add(5 * time.Second)
+	for root.LevelOverrides()["battle"] != WarnLevel {
+		if time.Now().After(deadline) {
+			t.Fatalf("levels %v, not reverted", root.LevelOverrides())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLevelHandlerDelete(t *testing.T) {
+	root := New()
+	root.SetLevelFor("battle", DebugLevel)
+	h := NewLevelHandler(root)
+
+	if w := serveLevel(h, http.MethodDelete, "/", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("DELETE without a name: %d, want 400", w.Code)
+	}
+	w := serveLevel(h, http.MethodDelete, "/?name=battle", "")
+	if w.Code != http.StatusOK || len(root.LevelOverrides()) != 0 {
+		t.Errorf("DELETE %d %s", w.Code, w.Body.String())
+	}
+	if w := serveLevel(h, http.MethodPost, "/", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST %d, want 405", w.Code)
+	}
+}
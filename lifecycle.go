@@ -0,0 +1,283 @@
+package galog
+
+import (
+	"context"
+)
+
+// RegisterType 账号注册方式
+type RegisterType int
+
+const (
+	RegisterGuest    RegisterType = 1 // 游客
+	RegisterPhone    RegisterType = 2 // 手机号
+	RegisterThird    RegisterType = 3 // 第三方账号（渠道SDK、微信、QQ等）
+	RegisterTransfer RegisterType = 4 // 游客绑定转正
+)
+
+// LevelUpReason 角色升级原因
+type LevelUpReason int
+
+const (
+	LevelUpExp      LevelUpReason = 1 // 经验累积
+	LevelUpItem     LevelUpReason = 2 // 使用道具直升
+	LevelUpGM       LevelUpReason = 3 // GM 调整
+	LevelUpActivity LevelUpReason = 4 // 活动奖励
+)
+
+// VipChangeReason VIP 等级变化原因
+type VipChangeReason int
+
+const (
+	VipChangeRecharge VipChangeReason = 1 // 充值累计
+	VipChangeGM       VipChangeReason = 2 // GM 调整
+	VipChangeExpire   VipChangeReason = 3 // 到期降级
+	VipChangeActivity VipChangeReason = 4 // 活动赠送
+	VipChangeRefund   VipChangeReason = 5 // 退款扣回
+)
+
+// RoleDeleteReason 角色删除原因
+type RoleDeleteReason int
+
+const (
+	RoleDeletePlayer   RoleDeleteReason = 1 // 玩家主动删除
+	RoleDeleteGM       RoleDeleteReason = 2 // GM 删除
+	RoleDeleteInactive RoleDeleteReason = 3 // 长期不活跃清理
+	RoleDeleteBan      RoleDeleteReason = 4 // 封禁删除
+	RoleDeleteAccount  RoleDeleteReason = 5 // 注销账号
+)
+
+// AccountRegister 账号注册
+type AccountRegister struct {
+	ZoneID        int          // 游戏区编号
+	EventTime     string       // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp     int64        // 时间戳，到毫秒，例如：1585903230000
+	GameID        int          // 游戏id
+	ChannelID     int          // 渠道ID，来源渠道配置表
+	AccountID     string       // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID        int          // 客户端平台 ios:2/android:1
+	RegisterType  RegisterType // 注册方式 1:游客 2:手机号 3:第三方账号 4:游客转正
+	DeviceID      string       // 设备ID（ios的idfa，android的imei或mac等）
+	ClientVersion string       // 客户端版本
+	ClientIP      string       // 客户端IP地址
+	OS            string       // 软件版本 操作系统版本
+	PhoneModel    string       // 硬件机型 品牌-型号
+	KvGroup       string       // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var accountregisterLogger *Logger
+
+// Log AccountRegister 写日志
+func (p AccountRegister) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext AccountRegister 写日志，附带 ctx 中的 trace_id 等字段
+func (p AccountRegister) LogContext(ctx context.Context) error {
+	return accountregisterLogger.logEvent(ctx, "accountregister", p, "AccountRegister - %d|%s|%d|%d|%d|%s|%d|%d|%s|%s|%s|%s|%s|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.ChannelID,
+		p.AccountID,
+		p.PlatID,
+		p.RegisterType,
+		p.DeviceID,
+		p.ClientVersion,
+		p.ClientIP,
+		p.OS,
+		p.PhoneModel,
+		p.KvGroup)
+}
+
+// RoleCreate 创建角色
+type RoleCreate struct {
+	ZoneID        int    // 游戏区编号
+	EventTime     string // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp     int64  // 时间戳，到毫秒，例如：1585903230000
+	GameID        int    // 游戏id
+	ChannelID     int    // 渠道ID，来源渠道配置表
+	AccountID     string // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID        int    // 客户端平台 ios:2/android:1
+	CharID        string // 角色id
+	CharName      string // 角色名字 UTF-8编码
+	Career        int    // 角色职业
+	CharType      int    // 角色类型，标识角色的分类属性，1:正常 2:测试 3:gm/福利 4:AI玩家  5:其他
+	DeviceID      string // 设备ID（ios的idfa，android的imei或mac等）
+	ClientVersion string // 客户端版本
+	ClientIP      string // 客户端IP地址
+	KvGroup       string // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var rolecreateLogger *Logger
+
+// Log RoleCreate 写日志
+func (p RoleCreate) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext RoleCreate 写日志，附带 ctx 中的 trace_id 等字段
+func (p RoleCreate) LogContext(ctx context.Context) error {
+	return rolecreateLogger.logEvent(ctx, "rolecreate", p, "RoleCreate - %d|%s|%d|%d|%d|%s|%d|%s|%s|%d|%d|%s|%s|%s|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.ChannelID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Career,
+		p.CharType,
+		p.DeviceID,
+		p.ClientVersion,
+		p.ClientIP,
+		p.KvGroup)
+}
+
+// LevelUp 角色升级，一次升多级时只记一条
+type LevelUp struct {
+	ZoneID      int           // 游戏区编号
+	EventTime   string        // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp   int64         // 时间戳，到毫秒，例如：1585903230000
+	GameID      int           // 游戏id
+	ChannelID   int           // 渠道ID，来源渠道配置表
+	AccountID   string        // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID      int           // 客户端平台 ios:2/android:1
+	CharID      string        // 角色id
+	CharName    string        // 角色名字 UTF-8编码
+	VipLevel    int           // 角色vip等级
+	LevelBefore int           // 升级前等级
+	LevelAfter  int           // 升级后等级
+	ExpAfter    int64         // 升级后当前等级的经验
+	Reason      LevelUpReason // 升级原因 1:经验累积 2:道具直升 3:GM调整 4:活动奖励
+	UseTime     int           // 距上次升级的时间(秒)
+	KvGroup     string        // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var levelupLogger *Logger
+
+// Log LevelUp 写日志
+func (p LevelUp) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext LevelUp 写日志，附带 ctx 中的 trace_id 等字段
+func (p LevelUp) LogContext(ctx context.Context) error {
+	return levelupLogger.logEvent(ctx, "levelup", p, "LevelUp - %d|%s|%d|%d|%d|%s|%d|%s|%s|%d|%d|%d|%d|%d|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.ChannelID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.VipLevel,
+		p.LevelBefore,
+		p.LevelAfter,
+		p.ExpAfter,
+		p.Reason,
+		p.UseTime,
+		p.KvGroup)
+}
+
+// VipChange 角色 VIP 等级变化
+type VipChange struct {
+	ZoneID       int             // 游戏区编号
+	EventTime    string          // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp    int64           // 时间戳，到毫秒，例如：1585903230000
+	GameID       int             // 游戏id
+	ChannelID    int             // 渠道ID，来源渠道配置表
+	AccountID    string          // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID       int             // 客户端平台 ios:2/android:1
+	CharID       string          // 角色id
+	CharName     string          // 角色名字 UTF-8编码
+	Level        int             // 角色触发当前事件时的等级
+	VipBefore    int             // 变化前 VIP 等级
+	VipAfter     int             // 变化后 VIP 等级
+	VipExpBefore int64           // 变化前 VIP 经验（累计充值点数）
+	VipExpAfter  int64           // 变化后 VIP 经验
+	Reason       VipChangeReason // 变化原因 1:充值累计 2:GM调整 3:到期降级 4:活动赠送 5:退款扣回
+	OrderID      string          // 关联充值订单号，无则为空
+	KvGroup      string          // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var vipchangeLogger *Logger
+
+// Log VipChange 写日志
+func (p VipChange) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext VipChange 写日志，附带 ctx 中的 trace_id 等字段
+func (p VipChange) LogContext(ctx context.Context) error {
+	return vipchangeLogger.logEvent(ctx, "vipchange", p, "VipChange - %d|%s|%d|%d|%d|%s|%d|%s|%s|%d|%d|%d|%d|%d|%d|%s|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.ChannelID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.VipBefore,
+		p.VipAfter,
+		p.VipExpBefore,
+		p.VipExpAfter,
+		p.Reason,
+		p.OrderID,
+		p.KvGroup)
+}
+
+// RoleDelete 删除角色
+type RoleDelete struct {
+	ZoneID     int              // 游戏区编号
+	EventTime  string           // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp  int64            // 时间戳，到毫秒，例如：1585903230000
+	GameID     int              // 游戏id
+	ChannelID  int              // 渠道ID，来源渠道配置表
+	AccountID  string           // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID     int              // 客户端平台 ios:2/android:1
+	CharID     string           // 角色id
+	CharName   string           // 角色名字 UTF-8编码
+	Level      int              // 删除时的等级
+	VipLevel   int              // 删除时的vip等级
+	Regtime    string           // 角色注册时间，格式 YYYY-MM-DD HH:MM:SS
+	OnlineTime int64            // 角色累计在线时间(秒)
+	Reason     RoleDeleteReason // 删除原因 1:玩家删除 2:GM删除 3:不活跃清理 4:封禁 5:注销账号
+	OperatorID string           // 操作人，GM 删除时为 GM 账号，否则为空
+	KvGroup    string           // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var roledeleteLogger *Logger
+
+// Log RoleDelete 写日志
+func (p RoleDelete) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext RoleDelete 写日志，附带 ctx 中的 trace_id 等字段
+func (p RoleDelete) LogContext(ctx context.Context) error {
+	return roledeleteLogger.logEvent(ctx, "roledelete", p, "RoleDelete - %d|%s|%d|%d|%d|%s|%d|%s|%s|%d|%d|%s|%d|%d|%s|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.ChannelID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.VipLevel,
+		p.Regtime,
+		p.OnlineTime,
+		p.Reason,
+		p.OperatorID,
+		p.KvGroup)
+}
@@ -0,0 +1,81 @@
+package galog
+
+import (
+	"strings"
+	"testing"
+)
+
+// eventLine logs an event through a fresh logger swapped in for the package
+// one and returns the line written, without its newline.
+func eventLine(t *testing.T, logger **Logger, log func() error) string {
+	t.Helper()
+	saved := *logger
+	defer func() { *logger = saved }()
+	out := new(lockedBuffer)
+	*logger = New()
+	(*logger).SetFormatter(&TextFormatter{DisableFormat: true})
+	(*logger).SetOutput(nopCloser{out})
+
+	if err := log(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+func TestLifecycleColumns(t *testing.T) {
+	for _, c := range []struct {
+		logger **Logger
+		log    func() error
+		want   string
+	}{
+		{
+			&accountregisterLogger,
+			AccountRegister{
+				ZoneID: 1, EventTime: "t", Timestamp: 2, GameID: 3, ChannelID: 4, AccountID: "a5", PlatID: 6,
+				RegisterType: RegisterThird, DeviceID: "d7", ClientVersion: "v8", ClientIP: "ip9",
+				OS: "os10", PhoneModel: "pm11", KvGroup: "{}",
+			}.Log,
+			"AccountRegister - 1|t|2|3|4|a5|6|3|d7|v8|ip9|os10|pm11|{}",
+		},
+		{
+			&rolecreateLogger,
+			RoleCreate{
+				ZoneID: 1, EventTime: "t", Timestamp: 2, GameID: 3, ChannelID: 4, AccountID: "a5", PlatID: 6,
+				CharID: "c7", CharName: "n8", Career: 9, CharType: 10, DeviceID: "d11",
+				ClientVersion: "v12", ClientIP: "ip13", KvGroup: "{}",
+			}.Log,
+			"RoleCreate - 1|t|2|3|4|a5|6|c7|n8|9|10|d11|v12|ip13|{}",
+		},
+		{
+			&levelupLogger,
+			LevelUp{
+				ZoneID: 1, EventTime: "t", Timestamp: 2, GameID: 3, ChannelID: 4, AccountID: "a5", PlatID: 6,
+				CharID: "c7", CharName: "n8", VipLevel: 9, LevelBefore: 10, LevelAfter: 11, ExpAfter: 12,
+				Reason: LevelUpGM, UseTime: 14, KvGroup: "{}",
+			}.Log,
+			"LevelUp - 1|t|2|3|4|a5|6|c7|n8|9|10|11|12|3|14|{}",
+		},
+		{
+			&vipchangeLogger,
+			VipChange{
+				ZoneID: 1, EventTime: "t", Timestamp: 2, GameID: 3, ChannelID: 4, AccountID: "a5", PlatID: 6,
+				CharID: "c7", CharName: "n8", Level: 9, VipBefore: 10, VipAfter: 11, VipExpBefore: 12,
+				VipExpAfter: 13, Reason: VipChangeRefund, OrderID: "o15", KvGroup: "{}",
+			}.Log,
+			"VipChange - 1|t|2|3|4|a5|6|c7|n8|9|10|11|12|13|5|o15|{}",
+		},
+		{
+			&roledeleteLogger,
+			RoleDelete{
+				ZoneID: 1, EventTime: "t", Timestamp: 2, GameID: 3, ChannelID: 4, AccountID: "a5", PlatID: 6,
+				CharID: "c7", CharName: "n8", Level: 9, VipLevel: 10, Regtime: "r11", OnlineTime: 12,
+				Reason: RoleDeleteBan, OperatorID: "g14", KvGroup: "{}",
+			}.Log,
+			"RoleDelete - 1|t|2|3|4|a5|6|c7|n8|9|10|r11|12|4|g14|{}",
+		},
+	} {
+		if got := eventLine(t, c.logger, c.log); got != c.want {
+			t.Errorf("line %q, want %q", got, c.want)
+		}
+	}
+}
@@ -2,11 +2,13 @@ package galog
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Level type
@@ -102,8 +104,40 @@ type Logger struct {
 	Level     Level
 	Out       Handler
 	Formatter Formatter
-	mu        MutexWrap
-	Buffer    *bytes.Buffer
+	// ExitFunc is called by the Fatal* methods once the message has been
+	// written and the handler flushed. Defaults to os.Exit; tests may
+	// replace it to observe fatal calls without terminating.
+	ExitFunc func(int)
+	// LogOnly keeps the historical behaviour of Fatal* and Panic*: they
+	// only write at their level and return, instead of exiting or
+	// panicking.
+	LogOnly bool
+	// Hooks fired for each entry before it is written, add them with
+	// AddHook.
+	Hooks LevelHooks
+	// AfterHooks fired for each entry once it is written, add them with
+	// AddAfterHook.
+	AfterHooks LevelHooks
+	// ReportCaller makes the entries carry the function logging them, for
+	// the formatter to write. New sets it, the event loggers do not.
+	ReportCaller bool
+	// ErrorHandler receives errors which can not be returned to the caller,
+	// such as those from hooks. Defaults to printing them on os.Stderr.
+	ErrorHandler func(error)
+	mu           MutexWrap
+	Buffer       *bytes.Buffer
+	// guards Hooks and AfterHooks, apart from mu which event loggers
+	// disable
+	hooksMu sync.RWMutex
+
+	// set on loggers returned by Named, see named.go
+	parent     *Logger
+	name       string
+	levels     levelRegistry
+	levelCache atomic.Value
+
+	// set on loggers returned by WithContext, see context.go
+	ctx context.Context
 }
 
 type MutexWrap struct {
@@ -130,9 +164,12 @@ func (mw *MutexWrap) Disable() {
 // New It's recommended to make this a global instance called `log`.
 func New() *Logger {
 	return &Logger{
-		Out:       os.Stdout,
-		Formatter: new(TextFormatter),
-		Level:     InfoLevel,
+		Out:          os.Stdout,
+		Formatter:    new(TextFormatter),
+		Level:        InfoLevel,
+		ExitFunc:     os.Exit,
+		Hooks:        make(LevelHooks),
+		ReportCaller: true,
 	}
 }
 
@@ -171,12 +208,18 @@ func (logger *Logger) Error(args ...interface{}) error {
 	return logger.Log(ErrorLevel, args...)
 }
 
+// Fatal logs at FatalLevel, flushes the output and calls ExitFunc(1).
 func (logger *Logger) Fatal(args ...interface{}) error {
-	return logger.Log(FatalLevel, args...)
+	err := logger.Log(FatalLevel, args...)
+	logger.exit(1)
+	return err
 }
 
+// Panic logs at PanicLevel and then panics with the message.
 func (logger *Logger) Panic(args ...interface{}) error {
-	return logger.Log(PanicLevel, args...)
+	err := logger.Log(PanicLevel, args...)
+	logger.panic(fmt.Sprint(args...))
+	return err
 }
 
 func (logger *Logger) Logf(level Level, format string, args ...interface{}) error {
@@ -215,11 +258,15 @@ func (logger *Logger) Errorf(format string, args ...interface{}) error {
 }
 
 func (logger *Logger) Fatalf(format string, args ...interface{}) error {
-	return logger.Logf(FatalLevel, format, args...)
+	err := logger.Logf(FatalLevel, format, args...)
+	logger.exit(1)
+	return err
 }
 
 func (logger *Logger) Panicf(format string, args ...interface{}) error {
-	return logger.Logf(PanicLevel, format, args...)
+	err := logger.Logf(PanicLevel, format, args...)
+	logger.panic(fmt.Sprintf(format, args...))
+	return err
 }
 
 func (logger *Logger) Logln(level Level, args ...interface{}) error {
@@ -258,48 +305,217 @@ func (logger *Logger) Errorln(args ...interface{}) error {
 }
 
 func (logger *Logger) Fatalln(args ...interface{}) error {
-	return logger.Logln(FatalLevel, args...)
+	err := logger.Logln(FatalLevel, args...)
+	logger.exit(1)
+	return err
 }
 
 func (logger *Logger) Panicln(args ...interface{}) error {
-	return logger.Logln(PanicLevel, args...)
+	err := logger.Logln(PanicLevel, args...)
+	logger.panic(fmt.Sprintln(args...))
+	return err
 }
 
 func (logger *Logger) log(level Level, msg string) error {
+	entry := logger.newEntry(level, msg)
+	if logger.reportCaller() {
+		entry.Caller = getCaller()
+	}
+	return logger.write(entry)
+}
+
+// callerReporter is implemented by handlers needing the caller of the
+// entries, see Destination.ReportCaller
+type callerReporter interface {
+	reportCaller() bool
+}
+
+// reportCaller tells whether the entries of the logger need their caller:
+// ReportCaller is set on the logger or one of its parents, or the output
+// asks for it. Walking the stack is skipped otherwise.
+func (logger *Logger) reportCaller() bool {
+	for l := logger; l != nil; l = l.parent {
+		if l.ReportCaller {
+			return true
+		}
+	}
+	logger.mutex().Lock()
+	defer logger.mutex().Unlock()
+	r, ok := logger.output().(callerReporter)
+	return ok && r.reportCaller()
+}
+
+func (logger *Logger) newEntry(level Level, msg string) *Entry {
+	entry := &Entry{
+		Logger:  logger,
+		Time:    time.Now(),
+		Level:   level,
+		Message: msg,
+		Name:    logger.name,
+	}
+	if ctx := logger.context(); ctx != nil {
+		entry.Context = ctx
+		entry.Fields = contextFields(ctx)
+	}
+	return entry
+}
+
+// write fires the hooks, formats the entry and writes it to the output,
+// then fires the after hooks
+func (logger *Logger) write(entry *Entry) error {
 	var buffer *bytes.Buffer
 
+	logger.fireHooks(entry, false)
+
 	buffer = getBuffer()
 	defer func() {
 		putBuffer(buffer)
 	}()
 	buffer.Reset()
 
-	serialized, err := logger.Formatter.Format(level, buffer, msg)
+	serialized, err := format(logger.formatter(), entry, buffer)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to obtain reader, %v\n", err)
 		return err
 	}
-	logger.mu.Lock()
-	defer logger.mu.Unlock()
-	if _, err := logger.Out.Write(serialized); err != nil {
+	logger.mutex().Lock()
+	_, err = writeEntry(logger.output(), entry, serialized)
+	logger.mutex().Unlock()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to write to log, %v\n", err)
+		return err
 	}
-	return err
+	logger.fireHooks(entry, true)
+	return nil
+}
+
+// number of hooks added by AddHook and AddAfterHook to any logger, for
+// fireHooks to return right away when there are none
+var hookCount int32
+
+// fireHooks fires the hooks of the logger and of its parents, the
+// AfterHooks if after is set.
+func (logger *Logger) fireHooks(entry *Entry, after bool) {
+	if atomic.LoadInt32(&hookCount) == 0 {
+		return
+	}
+	var hooks []Hook
+	for l := logger; l != nil; l = l.parent {
+		l.hooksMu.RLock()
+		levelHooks := l.Hooks
+		if after {
+			levelHooks = l.AfterHooks
+		}
+		hooks = append(hooks, levelHooks[entry.Level]...)
+		l.hooksMu.RUnlock()
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	for _, err := range (LevelHooks{entry.Level: hooks}).Fire(entry) {
+		logger.handleError(err)
+	}
+}
+
+func (logger *Logger) handleError(err error) {
+	for l := logger; l != nil; l = l.parent {
+		if l.ErrorHandler != nil {
+			l.ErrorHandler(err)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Failed to fire hook, %v\n", err)
+}
+
+// handlers flushed by every Fatal* call, see FlushOnExit
+var (
+	exitFlushersMutex sync.Mutex
+	exitFlushers      []Flusher
+)
+
+// FlushOnExit makes the Fatal* methods of every logger flush f before
+// calling ExitFunc, e.g. a SpoolHandler or a remote handler written to by
+// another logger than the one exiting. The event loggers and the outputs
+// added by AddOutput are always flushed.
+func FlushOnExit(f Flusher) {
+	exitFlushersMutex.Lock()
+	exitFlushers = append(exitFlushers, f)
+	exitFlushersMutex.Unlock()
+}
+
+// exit flushes the outputs and hands over to ExitFunc, unless LogOnly is
+// set.
+func (logger *Logger) exit(code int) {
+	if logger.logOnly() {
+		return
+	}
+	logger.Flush()
+	flushEvents()
+	exitFlushersMutex.Lock()
+	flushers := append([]Flusher(nil), exitFlushers...)
+	exitFlushersMutex.Unlock()
+	for _, f := range flushers {
+		if err := f.Flush(); err != nil {
+			logger.handleError(err)
+		}
+	}
+	exitFunc := os.Exit
+	for l := logger; l != nil; l = l.parent {
+		if l.ExitFunc != nil {
+			exitFunc = l.ExitFunc
+			break
+		}
+	}
+	exitFunc(code)
+}
+
+func (logger *Logger) panic(msg string) {
+	if logger.logOnly() {
+		return
+	}
+	panic(msg)
+}
+
+func (logger *Logger) logOnly() bool {
+	for l := logger; l != nil; l = l.parent {
+		if l.LogOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush flushes the output if it buffers writes, see Flusher. The logger
+// is not locked meanwhile, a MultiHandler may wait for its destinations.
+func (logger *Logger) Flush() error {
+	logger.mutex().Lock()
+	out := logger.output()
+	logger.mutex().Unlock()
+	return flush(out)
 }
 
 //When file is opened with appending mode, it's safe to
 //write concurrently to a file (within 4k message on Linux).
 //In these cases user can choose to disable the lock.
 func (logger *Logger) SetNoLock() {
-	logger.mu.Disable()
+	logger.mutex().Disable()
 }
 
 func (logger *Logger) level() Level {
+	if logger.parent != nil {
+		return logger.namedLevel()
+	}
 	return Level(atomic.LoadUint32((*uint32)(&logger.Level)))
 }
 
-// SetLevel sets the logger level.
+// SetLevel sets the logger level. On a named logger it is the same as
+// calling SetLevelFor with its name on the root logger.
 func (logger *Logger) SetLevel(level Level) {
+	if logger.parent != nil {
+		logger.root().SetLevelFor(logger.name, level)
+		return
+	}
 	atomic.StoreUint32((*uint32)(&logger.Level), uint32(level))
 }
 
@@ -312,16 +528,41 @@ func (logger *Logger) IsLevelEnabled(level Level) bool {
 	return logger.level() >= level
 }
 
+// AddHook adds a hook to the logger, fired before each entry is written.
+// It is safe to call while the logger is in use.
+func (logger *Logger) AddHook(hook Hook) {
+	logger.hooksMu.Lock()
+	defer logger.hooksMu.Unlock()
+	if logger.Hooks == nil {
+		logger.Hooks = make(LevelHooks)
+	}
+	logger.Hooks.Add(hook)
+	atomic.AddInt32(&hookCount, 1)
+}
+
+// AddAfterHook adds a hook to the logger, fired once each entry has been
+// written to the output, and not when the write failed, e.g. to count what
+// actually reached the files.
+func (logger *Logger) AddAfterHook(hook Hook) {
+	logger.hooksMu.Lock()
+	defer logger.hooksMu.Unlock()
+	if logger.AfterHooks == nil {
+		logger.AfterHooks = make(LevelHooks)
+	}
+	logger.AfterHooks.Add(hook)
+	atomic.AddInt32(&hookCount, 1)
+}
+
 // SetFormatter sets the logger formatter.
 func (logger *Logger) SetFormatter(formatter Formatter) {
-	logger.mu.Lock()
-	defer logger.mu.Unlock()
+	logger.mutex().Lock()
+	defer logger.mutex().Unlock()
 	logger.Formatter = formatter
 }
 
 // SetOutput sets the logger output.
 func (logger *Logger) SetOutput(output Handler) {
-	logger.mu.Lock()
-	defer logger.mu.Unlock()
+	logger.mutex().Lock()
+	defer logger.mutex().Unlock()
 	logger.Out = output
 }
@@ -0,0 +1,171 @@
+package galog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type flushRecorder struct {
+	bytes.Buffer
+	flushed int
+}
+
+func (f *flushRecorder) Flush() error {
+	f.flushed++
+	return nil
+}
+
+func (f *flushRecorder) Close() error {
+	return nil
+}
+
+func TestFatalFlushesRegisteredFlushers(t *testing.T) {
+	out := new(flushRecorder)
+	other := new(flushRecorder)
+	FlushOnExit(other)
+	defer func() { exitFlushers = nil }()
+
+	code := -1
+	logger := New()
+	logger.SetOutput(out)
+	logger.ExitFunc = func(c int) {
+		code = c
+		if out.flushed == 0 || other.flushed == 0 {
+			t.Errorf("ExitFunc called before flushing: output %d, other %d", out.flushed, other.flushed)
+		}
+	}
+	logger.Fatal("bye")
+	if code != 1 {
+		t.Fatalf("exit code %d, want 1", code)
+	}
+}
+
+// hungFlusher writes right away and flushes once released
+type hungFlusher struct {
+	lockedBuffer
+	release chan struct{}
+}
+
+func (h *hungFlusher) Flush() error {
+	<-h.release
+	return nil
+}
+
+func (h *hungFlusher) Close() error { return nil }
+
+func TestFlushDoesNotHoldLogger(t *testing.T) {
+	out := &hungFlusher{release: make(chan struct{})}
+	logger := New()
+	logger.SetOutput(out)
+
+	flushed := make(chan struct{})
+	go func() {
+		logger.Flush()
+		close(flushed)
+	}()
+	logged := make(chan struct{})
+	go func() {
+		logger.Info("during flush")
+		close(logged)
+	}()
+	select {
+	case <-logged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Info waited for Flush")
+	}
+	close(out.release)
+	<-flushed
+}
+
+// prefixFormatter writes the message after a prefix, to tell formatters apart
+type prefixFormatter string
+
+func (f prefixFormatter) Format(level Level, buffer *bytes.Buffer, msg string) ([]byte, error) {
+	return []byte(string(f) + msg + "\n"), nil
+}
+
+func TestNamedInheritsOutputAndFormatter(t *testing.T) {
+	var rootOut, battleOut bytes.Buffer
+	root := New()
+	root.SetOutput(nopCloser{&rootOut})
+	root.SetFormatter(prefixFormatter("root: "))
+	battle := root.Named("battle")
+	skill := battle.Named("skill")
+	if skill.Name() != "battle.skill" {
+		t.Fatalf("name %q", skill.Name())
+	}
+
+	skill.Info("a")
+	if rootOut.String() != "root: a\n" {
+		t.Fatalf("root output %q", rootOut.String())
+	}
+
+	// the closest parent with an output or a formatter wins
+	battle.SetOutput(nopCloser{&battleOut})
+	skill.Info("b")
+	battle.SetFormatter(prefixFormatter("battle: "))
+	skill.Info("c")
+	root.Info("d")
+	if battleOut.String() != "root: b\nbattle: c\n" {
+		t.Errorf("battle output %q", battleOut.String())
+	}
+	if rootOut.String() != "root: a\nroot: d\n" {
+		t.Errorf("root output %q", rootOut.String())
+	}
+}
+
+func TestSetLevelFor(t *testing.T) {
+	root := New()
+	battle := root.Named("battle")
+	skill := battle.Named("skill")
+	ground := root.Named("battleground")
+
+	root.SetLevelFor("battle", DebugLevel)
+	if !battle.IsLevelEnabled(DebugLevel) || !skill.IsLevelEnabled(DebugLevel) {
+		t.Error("battle override not applied to battle and battle.skill")
+	}
+	if ground.IsLevelEnabled(DebugLevel) || root.IsLevelEnabled(DebugLevel) {
+		t.Error("battle override applied to battleground or the root")
+	}
+
+	// the longest prefix wins
+	skill.SetLevelFor("battle.skill", ErrorLevel)
+	if skill.IsLevelEnabled(WarnLevel) || !battle.IsLevelEnabled(DebugLevel) {
+		t.Error("battle.skill override not applied to battle.skill alone")
+	}
+	root.ClearLevelFor("battle.skill")
+	if !skill.IsLevelEnabled(DebugLevel) {
+		t.Error("battle.skill does not fall back to battle once cleared")
+	}
+
+	// an empty name is the root level, used by names without an override
+	root.SetLevelFor("", WarnLevel)
+	if root.GetLevel() != WarnLevel || ground.IsLevelEnabled(InfoLevel) || !skill.IsLevelEnabled(DebugLevel) {
+		t.Error("root level not set, or applied over the battle override")
+	}
+
+	if levels := root.LevelOverrides(); len(levels) != 1 || levels["battle"] != DebugLevel {
+		t.Errorf("overrides %v", levels)
+	}
+}
+
+func TestPanicWritesThenPanics(t *testing.T) {
+	var out bytes.Buffer
+	logger := New()
+	logger.SetFormatter(&TextFormatter{DisableFormat: true})
+	logger.SetOutput(nopCloser{&out})
+
+	defer func() {
+		r := recover()
+		if r != "boom 1" {
+			t.Fatalf("recovered %v, want the message", r)
+		}
+		if !strings.Contains(out.String(), "boom 1") {
+			t.Errorf("output %q, entry not written before panicking", out.String())
+		}
+	}()
+	logger.Panic("boom ", 1)
+	t.Fatal("Panic returned")
+}
@@ -0,0 +1,317 @@
+package galog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// default labels of LokiHandler streams
+var defaultLokiLabels = []string{"level", "logger", "event", "zone_id"}
+
+// LokiOptions configures a LokiHandler, zero values use the defaults.
+type LokiOptions struct {
+	BatchOptions
+	RetryOptions
+
+	// Labels of the streams. "level", "logger" and "event" are taken from
+	// the entry, fields of the same name are not available as labels, other
+	// names from its fields, e.g. "zone_id" from the ZoneID of events.
+	// Labels without a value are left out. By default level, logger, event
+	// and zone_id.
+	Labels []string
+
+	// StaticLabels are added to every stream, {job="galog"} by default
+	StaticLabels map[string]string
+
+	// Protobuf sends snappy compressed protobuf instead of JSON
+	Protobuf bool
+
+	// TenantID is sent as X-Scope-OrgID for multi-tenant Loki
+	TenantID string
+
+	// Header is added to every request, e.g. for authentication
+	Header http.Header
+
+	// Client used for requests, http.DefaultClient by default
+	Client *http.Client
+
+	// ErrorHandler receives delivery errors, they are printed on os.Stderr
+	// by default.
+	ErrorHandler func(error)
+}
+
+type lokiEntry struct {
+	labels   string // rendered, the key of the stream
+	labelSet map[string]string
+	time     time.Time
+	line     string
+}
+
+type lokiStream struct {
+	labels   string
+	labelSet map[string]string
+	entries  []*lokiEntry
+}
+
+// LokiHandler pushes logs to Grafana Loki.
+//
+// Entries are grouped in streams by their labels, see LokiOptions.Labels,
+// and sent in batches from a background goroutine, see BatchOptions, in
+// timestamp order within each stream.
+type LokiHandler struct {
+	sender       *httpSender
+	batcher      *batcher
+	labels       []string
+	static       map[string]string
+	protobuf     bool
+	errorHandler func(error)
+}
+
+// NewLokiHandler return LokiHandler pushing to the Loki server at url, e.g.
+// "http://loki:3100"
+func NewLokiHandler(url string, opts LokiOptions) (*LokiHandler, error) {
+	h := new(LokiHandler)
+
+	if opts.Labels == nil {
+		opts.Labels = defaultLokiLabels
+	}
+	if opts.StaticLabels == nil {
+		opts.StaticLabels = map[string]string{"job": "galog"}
+	}
+	header := http.Header{}
+	for k, v := range opts.Header {
+		header[k] = v
+	}
+	if opts.TenantID != "" {
+		header.Set("X-Scope-OrgID", opts.TenantID)
+	}
+	opts.BatchOptions.setDefaults()
+
+	h.sender = newHTTPSender(strings.TrimRight(url, "/")+lokiPushPath, opts.Client, header, false, opts.RetryOptions)
+	h.labels = opts.Labels
+	h.static = opts.StaticLabels
+	h.protobuf = opts.Protobuf
+	h.errorHandler = opts.ErrorHandler
+	if h.errorHandler == nil {
+		h.errorHandler = defaultErrorHandler("Failed to push logs to loki")
+	}
+	h.batcher = newBatcher(opts.BatchOptions, h.deliver)
+	h.batcher.drop = h.drop
+
+	return h, nil
+}
+
+// Write queues p in the stream of the static labels
+func (h *LokiHandler) Write(p []byte) (n int, err error) {
+	return h.add(h.entry(nil, p))
+}
+
+// WriteEntry queues p in the stream of the entry labels
+func (h *LokiHandler) WriteEntry(entry *Entry, p []byte) (n int, err error) {
+	return h.add(h.entry(entry, p))
+}
+
+// entry builds the Loki entry of p, in the stream of the static labels if
+// entry is nil
+func (h *LokiHandler) entry(entry *Entry, p []byte) *lokiEntry {
+	e := &lokiEntry{
+		time: time.Now(),
+		line: strings.TrimSuffix(string(p), "\n"),
+	}
+	if entry != nil {
+		e.time = entry.Time
+	}
+	e.labels, e.labelSet = h.streamLabels(entry)
+	return e
+}
+
+func (h *LokiHandler) add(e *lokiEntry) (int, error) {
+	if err := h.batcher.add(e, len(e.line)+len(e.labels)); err != nil {
+		return 0, err
+	}
+	return len(e.line), nil
+}
+
+// streamLabels returns the labels of an entry, and their rendering as a
+// LogQL selector which also serves as the stream key:
+// {event="playerlogin", job="galog"}
+func (h *LokiHandler) streamLabels(entry *Entry) (string, map[string]string) {
+	labels := make(map[string]string, len(h.static)+len(h.labels))
+	for k, v := range h.static {
+		labels[k] = v
+	}
+	if entry != nil {
+		for _, name := range h.labels {
+			if v := lokiLabelValue(entry, name); v != "" {
+				labels[name] = v
+			}
+		}
+	}
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k + "=" + strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String(), labels
+}
+
+func lokiLabelValue(entry *Entry, name string) string {
+	switch name {
+	case "level":
+		// the attribute of the entry, like the other handlers, not the
+		// character level of the events
+		return entry.Level.String()
+	case "logger":
+		return entry.Name
+	case "event":
+		return entry.Event
+	}
+	if v, ok := entry.Fields[name]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// deliver pushes a batch of queued entries
+func (h *LokiHandler) deliver(items []interface{}) {
+	entries := make([]*lokiEntry, len(items))
+	for i, item := range items {
+		entries[i] = item.(*lokiEntry)
+	}
+	if err := h.push(entries); err != nil {
+		h.errorHandler(fmt.Errorf("%d entries lost, %v", len(items), err))
+	}
+}
+
+// push groups entries in streams and posts them, retrying as configured
+func (h *LokiHandler) push(entries []*lokiEntry) error {
+	var streams []*lokiStream
+	byLabels := make(map[string]*lokiStream)
+	for _, e := range entries {
+		s, ok := byLabels[e.labels]
+		if !ok {
+			s = &lokiStream{labels: e.labels, labelSet: e.labelSet}
+			byLabels[e.labels] = s
+			streams = append(streams, s)
+		}
+		s.entries = append(s.entries, e)
+	}
+	for _, s := range streams {
+		sort.SliceStable(s.entries, func(i, j int) bool {
+			return s.entries[i].time.Before(s.entries[j].time)
+		})
+	}
+
+	var err error
+	if h.protobuf {
+		_, err = h.sender.post(snappyEncode(encodeLokiProtobuf(streams)), "application/x-protobuf")
+	} else {
+		var body []byte
+		if body, err = encodeLokiJSON(streams); err == nil {
+			_, err = h.sender.post(body, "application/json")
+		}
+	}
+	return err
+}
+
+// WriteEntryBatch pushes records right away, bypassing the queue, and
+// returns once they are delivered or retries ran out. A nil entry stands
+// for a record written with Write. It makes LokiHandler an
+// EntryBatchWriter, to be used as the output of a SpoolHandler.
+func (h *LokiHandler) WriteEntryBatch(entries []*Entry, records [][]byte) error {
+	batch := make([]*lokiEntry, len(records))
+	for i, p := range records {
+		batch[i] = h.entry(entries[i], p)
+	}
+	return h.push(batch)
+}
+
+// cancelBatch stops retrying, for SpoolHandler.Close
+func (h *LokiHandler) cancelBatch() {
+	h.sender.close()
+}
+
+// encodeLokiJSON builds
+// {"streams":[{"stream":{"label":"value"},"values":[["<unix ns>","<line>"]]}]}
+func encodeLokiJSON(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	req := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+
+	for _, s := range streams {
+		js := jsonStream{
+			Stream: s.labelSet,
+			Values: make([][2]string, len(s.entries)),
+		}
+		for i, e := range s.entries {
+			js.Values[i] = [2]string{strconv.FormatInt(e.time.UnixNano(), 10), e.line}
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
+
+// encodeLokiProtobuf builds a logproto.PushRequest:
+//
+//	PushRequest   { repeated StreamAdapter streams = 1; }
+//	StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	EntryAdapter  { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func encodeLokiProtobuf(streams []*lokiStream) []byte {
+	var p protoBuffer
+	for _, s := range streams {
+		p.message(1, func(m *protoBuffer) {
+			m.string(1, s.labels)
+			for _, e := range s.entries {
+				m.message(2, func(m *protoBuffer) {
+					m.message(1, func(m *protoBuffer) {
+						m.uint64(1, uint64(e.time.Unix()))
+						m.uint64(2, uint64(e.time.Nanosecond()))
+					})
+					m.string(2, e.line)
+				})
+			}
+		})
+	}
+	return p.b
+}
+
+// drop reports the entries left when Close timed out
+func (h *LokiHandler) drop(items []interface{}) {
+	h.errorHandler(fmt.Errorf("%d entries dropped, handler closed", len(items)))
+}
+
+// Flush pushes the queued entries and waits for the request to complete
+func (h *LokiHandler) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close pushes the queued entries, retrying as configured, and stops the
+// handler. It waits up to CloseTimeout, the entries left are dropped.
+func (h *LokiHandler) Close() error {
+	h.batcher.close()
+	h.sender.close()
+	return nil
+}
@@ -0,0 +1,145 @@
+package galog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLokiHandlerJSON(t *testing.T) {
+	c := &collector{replies: []int{http.StatusInternalServerError}}
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		c.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	h, err := NewLokiHandler(srv.URL+"/", LokiOptions{
+		RetryOptions: fastRetry,
+		TenantID:     "zone-1",
+		BatchOptions: BatchOptions{FlushInterval: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Unix(1585903230, 0)
+	h.WriteEntry(&Entry{Time: t0.Add(time.Second), Level: InfoLevel, Event: "playerlogin", Fields: Fields{"zone_id": 1, "level": 12}}, []byte("second\n"))
+	h.WriteEntry(&Entry{Time: t0, Level: InfoLevel, Event: "playerlogin", Fields: Fields{"zone_id": 1, "level": 30}}, []byte("first\n"))
+	h.WriteEntry(&Entry{Time: t0, Level: ErrorLevel, Name: "battle"}, []byte("other\n"))
+	// Close pushes what is queued, and retries the 500
+	h.Close()
+
+	if path != lokiPushPath {
+		t.Errorf("path %q, want %q", path, lokiPushPath)
+	}
+	bodies := c.received()
+	if len(bodies) != 2 || bodies[0] != bodies[1] {
+		t.Fatalf("%d requests, want the same one twice", len(bodies))
+	}
+	if tenant := c.headers[1].Get("X-Scope-OrgID"); tenant != "zone-1" {
+		t.Errorf("tenant %q", tenant)
+	}
+
+	var req struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal([]byte(bodies[1]), &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Streams) != 2 {
+		t.Fatalf("%d streams, want 2", len(req.Streams))
+	}
+	event := req.Streams[0]
+	// the level label is the level of the entry, not the character level
+	want := map[string]string{"job": "galog", "level": "info", "event": "playerlogin", "zone_id": "1"}
+	if !reflect.DeepEqual(event.Stream, want) {
+		t.Errorf("labels %v, want %v", event.Stream, want)
+	}
+	if len(event.Values) != 2 || event.Values[0] != [2]string{"1585903230000000000", "first"} || event.Values[1][1] != "second" {
+		t.Errorf("values %v, want in time order", event.Values)
+	}
+	if req.Streams[1].Stream["logger"] != "battle" || req.Streams[1].Stream["level"] != "error" {
+		t.Errorf("labels %v", req.Streams[1].Stream)
+	}
+}
+
+func TestLokiHandlerProtobuf(t *testing.T) {
+	var body []byte
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	h, _ := NewLokiHandler(srv.URL, LokiOptions{Protobuf: true, StaticLabels: map[string]string{}})
+	t0 := time.Unix(1585903230, 500)
+	h.WriteEntry(&Entry{Time: t0, Level: WarnLevel}, []byte("line\n"))
+	h.Close()
+
+	if contentType != "application/x-protobuf" {
+		t.Errorf("content type %q", contentType)
+	}
+	raw, err := testSnappyDecode(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := testDecodeProto(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams := protoGet(req, 1)
+	if len(streams) != 1 {
+		t.Fatalf("%d streams", len(streams))
+	}
+	stream, _ := testDecodeProto(streams[0].b)
+	if labels := string(protoGet(stream, 1)[0].b); labels != `{level="warn"}` {
+		t.Errorf("labels %s", labels)
+	}
+	entry, _ := testDecodeProto(protoGet(stream, 2)[0].b)
+	ts, _ := testDecodeProto(protoGet(entry, 1)[0].b)
+	if protoGet(ts, 1)[0].v != 1585903230 || protoGet(ts, 2)[0].v != 500 {
+		t.Errorf("timestamp %v", ts)
+	}
+	if line := string(protoGet(entry, 2)[0].b); line != "line" {
+		t.Errorf("line %q", line)
+	}
+}
+
+func TestLokiHandlerCloseTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	errs := make(chan error, 2)
+	h, _ := NewLokiHandler(srv.URL, LokiOptions{
+		BatchOptions: BatchOptions{BatchSize: 1, CloseTimeout: 50 * time.Millisecond},
+		RetryOptions: RetryOptions{MaxRetries: 100, MinBackoff: time.Minute, MaxBackoff: time.Minute},
+		ErrorHandler: func(err error) { errs <- err },
+	})
+	h.Write([]byte("a"))
+	h.Write([]byte("b"))
+
+	start := time.Now()
+	h.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Close took %v", d)
+	}
+	// the entry being retried is lost, the other one dropped
+	for i := 0; i < 2; i++ {
+		select {
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d errors reported, want 2", i)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package galog
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path"
+	"sync/atomic"
 )
 
 // Playerlogin 玩家登录
@@ -39,7 +44,12 @@ var playerloginLogger *Logger
 
 // Log Playerlogin 写日志
 func (p Playerlogin) Log() error {
-	return playerloginLogger.Infof("Playerlogin - %d|%s|%d|%d|%d|%s|%d|%s|%s|%s|%s|%s|%d|%d|%d|%s|%d|%s|%s|%s|%s|%s|%s|%d|%s|%s\n",
+	return p.LogContext(context.Background())
+}
+
+// LogContext Playerlogin 写日志，附带 ctx 中的 trace_id 等字段
+func (p Playerlogin) LogContext(ctx context.Context) error {
+	return playerloginLogger.logEvent(ctx, "playerlogin", p, "Playerlogin - %d|%s|%d|%d|%d|%s|%d|%s|%s|%s|%s|%s|%d|%d|%d|%s|%d|%s|%s|%s|%s|%s|%s|%d|%s|%s\n",
 		p.ZoneID,
 		p.EventTime,
 		p.Timestamp,
@@ -103,7 +113,12 @@ var playerlogoutLogger *Logger
 
 // Log Playerlogout 写日志
 func (p Playerlogout) Log() error {
-	return playerlogoutLogger.Infof("Playerlogout - %d|%s|%d|%d|%d|%s|%d|%s|%s|%s|%s|%s|%d|%d|%d|%d|%d|%d|%s|%s|%s|%s|%s|%s|%d|%s|%s\n",
+	return p.LogContext(context.Background())
+}
+
+// LogContext Playerlogout 写日志，附带 ctx 中的 trace_id 等字段
+func (p Playerlogout) LogContext(ctx context.Context) error {
+	return playerlogoutLogger.logEvent(ctx, "playerlogout", p, "Playerlogout - %d|%s|%d|%d|%d|%s|%d|%s|%s|%s|%s|%s|%d|%d|%d|%d|%d|%d|%s|%s|%s|%s|%s|%s|%d|%s|%s\n",
 		p.ZoneID,
 		p.EventTime,
 		p.Timestamp,
@@ -160,7 +175,18 @@ var roundflowLogger *Logger
 
 // Log Roundflow 写日志
 func (p Roundflow) Log() error {
-	return roundflowLogger.Infof("Roundflow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%s|%d|%s|%s|%d|%d|%d|%d|%d|%s\n",
+	return p.LogContext(context.Background())
+}
+
+// LogContext Roundflow 写日志，附带 ctx 中的 trace_id 等字段。
+// 设置了 SetRoundflowAnalyzer 时，写入成功后分析该对局，命中规则的另写 SecurityFlow；
+// 对局已写入，SecurityFlow 的错误交给 ErrorHandler，不作为返回值，以免调用方重试时重复写入
+func (p Roundflow) LogContext(ctx context.Context) error {
+	if !roundflowLogger.IsLevelEnabled(InfoLevel) {
+		// a round not logged is not analyzed either
+		return nil
+	}
+	err := roundflowLogger.logEvent(ctx, "roundflow", p, "Roundflow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%s|%d|%s|%s|%d|%d|%d|%d|%d|%s\n",
 		p.ZoneID,
 		p.EventTime,
 		p.Timestamp,
@@ -180,38 +206,109 @@ func (p Roundflow) Log() error {
 		p.Result,
 		p.rank,
 		p.KvGroup)
+	if err != nil {
+		// a round not in the files is not recorded in the history either
+		return err
+	}
+	if err := analyzeRound(ctx, p); err != nil {
+		roundflowLogger.handleError(err)
+	}
+	return nil
 }
 
-// Init sdk init
-func Init(logpath string, rollingtime Rollingtime, rollinginterval int) error {
-	var err error
+// eventLoggers are the loggers of the events, each writing its own rotated
+// file named after ident. Init opens them, Clean closes them.
+var eventLoggers = []struct {
+	ident  string
+	logger **Logger
+}{
+	{"playerlogin", &playerloginLogger},
+	{"playerlogout", &playerlogoutLogger},
+	{"roundflow", &roundflowLogger},
+	{"moneyflow", &moneyflowLogger},
+	{"itemflow", &itemflowLogger},
+	{"payflow", &payflowLogger},
+	{"accountregister", &accountregisterLogger},
+	{"rolecreate", &rolecreateLogger},
+	{"levelup", &levelupLogger},
+	{"vipchange", &vipchangeLogger},
+	{"roledelete", &roledeleteLogger},
+	{"taskflow", &taskflowLogger},
+	{"guideflow", &guideflowLogger},
+	{"guildflow", &guildflowLogger},
+	{"friendflow", &friendflowLogger},
+	{"chatflow", &chatflowLogger},
+	{"serversnapshot", &serversnapshotLogger},
+	{"gachaflow", &gachaflowLogger},
+	{"securityflow", &securityflowLogger},
+	{"clientcrash", &clientcrashLogger},
+	{"clientperf", &clientperfLogger},
+}
 
-	playerloginLogger, err = getLogger(logpath, "playerlogin", rollingtime, rollinginterval)
-	if err != nil {
+// Init sdk init. The file of an event is created when the first one is
+// logged, a game logging a few of them does not get empty files for the
+// others, but logpath is created and checked to be writable right away.
+func Init(logpath string, rollingtime Rollingtime, rollinginterval int) error {
+	if chatTextEnabled && len(chatHashKey) == 0 {
+		// chattext lines are joined to chatflow by MsgHash
+		return errors.New("galog: EnableChatText requires SetChatHashKey")
+	}
+	if err := checkLogPath(logpath); err != nil {
 		return err
 	}
+	for _, e := range eventLoggers {
+		logger, err := getLogger(logpath, e.ident, rollingtime, rollinginterval, 0666)
+		if err != nil {
+			return err
+		}
+		// the outputs of AddOutput are appended to it, the event loggers
+		// do not lock so Out is never swapped once they are in use
+		output, _ := NewMultiHandler(Destination{Handler: logger.Out, Sync: true})
+		logger.SetOutput(output)
+		*e.logger = logger
+	}
+	if chatTextEnabled {
+		// chattext and gmaudit are not in eventLoggers, they stay out of
+		// AddOutput
+		logger, err := getLogger(logpath, "chattext", rollingtime, rollinginterval, 0600)
+		if err != nil {
+			return err
+		}
+		chattextLogger = logger
+	}
+	if gmauditKey != nil {
+		logger, err := getLogger(logpath, "gmaudit", rollingtime, rollinginterval, 0666)
+		if err != nil {
+			return err
+		}
+		logger.SetOutput(&auditChainHandler{h: logger.Out.(*TimeRotatingFileHandler), key: gmauditKey})
+		gmauditLogger = logger
+	}
+	return nil
+}
 
-	playerlogoutLogger, err = getLogger(logpath, "playerlogout", rollingtime, rollinginterval)
-	if err != nil {
+// checkLogPath creates logpath and a file in it, so that Init reports what
+// would fail every event later
+func checkLogPath(logpath string) error {
+	if err := os.MkdirAll(logpath, 0777); err != nil {
 		return err
 	}
-
-	roundflowLogger, err = getLogger(logpath, "roundflow", rollingtime, rollinginterval)
+	f, err := ioutil.TempFile(logpath, ".galog")
 	if err != nil {
 		return err
 	}
-
-	return nil
+	f.Close()
+	return os.Remove(f.Name())
 }
 
-func getLogger(logpath string, ident string, rollingtime Rollingtime, rollinginterval int) (*Logger, error) {
+func getLogger(logpath string, ident string, rollingtime Rollingtime, rollinginterval int, perm os.FileMode) (*Logger, error) {
 	logger := new(Logger)
 	formatter := TextFormatter{
 		DisableFormat: true,
 	}
 	logger.SetFormatter(&formatter)
 	logger.SetNoLock()
-	output, err := NewTimeRotatingFileHandler(path.Join(logpath, ident), rollingtime, rollinginterval)
+	output, err := newTimeRotatingFileHandler(path.Join(logpath, ident), rollingtime, rollinginterval, perm, true)
 	if err != nil {
 		fmt.Println("[ERROR]", err.Error())
 		return nil, err
@@ -221,10 +318,94 @@ func getLogger(logpath string, ident string, rollingtime Rollingtime, rollingint
 	return logger, nil
 }
 
+// outputs added by AddOutput, shared by every event logger, and their
+// number for logEvent to read
+var (
+	eventOutputs     []Handler
+	eventOutputCount int32
+)
+
+// AddOutput makes every event also written to h besides its rotated file,
+// e.g. a ForwardHandler shipping them to fluentd. It returns an error before
+// Init, h is closed by Clean.
+func AddOutput(h Handler) error {
+	outputs := make([]*MultiHandler, len(eventLoggers))
+	for i, e := range eventLoggers {
+		logger := *e.logger
+		if logger == nil {
+			return errors.New("galog: AddOutput called before Init")
+		}
+		outputs[i] = logger.Out.(*MultiHandler)
+	}
+
+	for _, output := range outputs {
+		if err := output.add(Destination{Handler: sharedHandler{h}}); err != nil {
+			return err
+		}
+	}
+	eventOutputs = append(eventOutputs, h)
+	atomic.StoreInt32(&eventOutputCount, int32(len(eventOutputs)))
+	return nil
+}
+
+// sharedHandler shields a handler used by several loggers from being closed
+// by each of them.
+type sharedHandler struct {
+	Handler
+}
+
+func (h sharedHandler) WriteEntry(entry *Entry, p []byte) (n int, err error) {
+	return writeEntry(h.Handler, entry, p)
+}
+
+func (h sharedHandler) Flush() error {
+	if f, ok := h.Handler.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (h sharedHandler) Close() error {
+	return nil
+}
+
+// flushEvents flushes the event loggers, and through them the outputs
+// added by AddOutput
+func flushEvents() {
+	for _, e := range eventLoggers {
+		if *e.logger != nil {
+			(*e.logger).Flush()
+		}
+	}
+	if chattextLogger != nil {
+		chattextLogger.Flush()
+	}
+	if gmauditLogger != nil {
+		gmauditLogger.Flush()
+	}
+}
+
 // Clean loggers clean
 func Clean() {
+	stopServerSnapshot()
+
+	for _, e := range eventLoggers {
+		if *e.logger != nil {
+			(*e.logger).Out.Close()
+		}
+	}
+	if chattextLogger != nil {
+		chattextLogger.Out.Close()
+		chattextLogger = nil
+	}
+	if gmauditLogger != nil {
+		gmauditLogger.Out.Close()
+		gmauditLogger = nil
+	}
 
-	playerloginLogger.Out.Close()
-	playerlogoutLogger.Out.Close()
-	roundflowLogger.Out.Close()
+	for _, h := range eventOutputs {
+		h.Close()
+	}
+	eventOutputs = nil
+	atomic.StoreInt32(&eventOutputCount, 0)
 }
@@ -0,0 +1,95 @@
+package galog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitOpensFilesOnFirstEvent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := Init(dir, WhenDay, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer Clean()
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("%d files created by Init, want none", len(files))
+	}
+	if err := (Playerlogin{ZoneID: 1}).Log(); err != nil {
+		t.Fatal(err)
+	}
+	flushEvents()
+
+	files, _ := ioutil.ReadDir(dir)
+	want := "playerlogin." + time.Now().Format("2006-01-02")
+	if len(files) != 1 || files[0].Name() != want {
+		t.Fatalf("files %v, want only %s", files, want)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, want))
+	if err != nil || !strings.HasPrefix(string(b), "Playerlogin - 1|") {
+		t.Errorf("file %q, %v", b, err)
+	}
+}
+
+func TestInitUnwritableLogpath(t *testing.T) {
+	f, err := ioutil.TempFile("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	// a file where a directory is expected
+	if err := Init(filepath.Join(f.Name(), "sub"), WhenDay, 1); err == nil {
+		Clean()
+		t.Fatal("Init succeeded")
+	}
+}
+
+func TestAddOutput(t *testing.T) {
+	saved := playerloginLogger
+	playerloginLogger = nil
+	err := AddOutput(&NullHandler{})
+	playerloginLogger = saved
+	if err == nil {
+		t.Fatal("AddOutput before Init succeeded")
+	}
+
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := Init(dir, WhenDay, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer Clean()
+
+	out := playerloginLogger.Out
+	var first, second lockedBuffer
+	if err := AddOutput(nopCloser{&first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddOutput(nopCloser{&second}); err != nil {
+		t.Fatal(err)
+	}
+	// the outputs are appended to the handler the logger already uses
+	if playerloginLogger.Out != out || len(out.(*MultiHandler).dests) != 3 {
+		t.Fatalf("output %T swapped or nested", playerloginLogger.Out)
+	}
+	if err := (Playerlogin{ZoneID: 1}).Log(); err != nil {
+		t.Fatal(err)
+	}
+	flushEvents()
+	if !strings.HasPrefix(first.String(), "Playerlogin - 1|") || first.String() != second.String() {
+		t.Errorf("outputs %q and %q", first.String(), second.String())
+	}
+}
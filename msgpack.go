@@ -0,0 +1,435 @@
+package galog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Just enough MessagePack for the Fluentd Forward protocol: encoding of the
+// values found in entries, and decoding of the string maps sent as acks.
+// See https://github.com/msgpack/msgpack/blob/master/spec.md
+
+type msgpackEncoder struct {
+	buf *bytes.Buffer
+}
+
+func (e msgpackEncoder) writeUint(prefix byte, v uint64, size int) {
+	var b [9]byte
+	b[0] = prefix
+	switch size {
+	case 1:
+		b[1] = byte(v)
+	case 2:
+		binary.BigEndian.PutUint16(b[1:], uint16(v))
+	case 4:
+		binary.BigEndian.PutUint32(b[1:], uint32(v))
+	case 8:
+		binary.BigEndian.PutUint64(b[1:], v)
+	}
+	e.buf.Write(b[:1+size])
+}
+
+func (e msgpackEncoder) encodeNil() {
+	e.buf.WriteByte(0xc0)
+}
+
+func (e msgpackEncoder) encodeBool(v bool) {
+	if v {
+		e.buf.WriteByte(0xc3)
+	} else {
+		e.buf.WriteByte(0xc2)
+	}
+}
+
+func (e msgpackEncoder) encodeInt(v int64) {
+	switch {
+	case v >= 0:
+		e.encodeUint(uint64(v))
+	case v >= -32:
+		e.buf.WriteByte(byte(v))
+	case v >= math.MinInt8:
+		e.writeUint(0xd0, uint64(v), 1)
+	case v >= math.MinInt16:
+		e.writeUint(0xd1, uint64(v), 2)
+	case v >= math.MinInt32:
+		e.writeUint(0xd2, uint64(v), 4)
+	default:
+		e.writeUint(0xd3, uint64(v), 8)
+	}
+}
+
+func (e msgpackEncoder) encodeUint(v uint64) {
+	switch {
+	case v <= 0x7f:
+		e.buf.WriteByte(byte(v))
+	case v <= math.MaxUint8:
+		e.writeUint(0xcc, v, 1)
+	case v <= math.MaxUint16:
+		e.writeUint(0xcd, v, 2)
+	case v <= math.MaxUint32:
+		e.writeUint(0xce, v, 4)
+	default:
+		e.writeUint(0xcf, v, 8)
+	}
+}
+
+func (e msgpackEncoder) encodeFloat(v float64) {
+	e.writeUint(0xcb, math.Float64bits(v), 8)
+}
+
+func (e msgpackEncoder) encodeString(s string) {
+	n := uint64(len(s))
+	switch {
+	case n <= 31:
+		e.buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.writeUint(0xd9, n, 1)
+	case n <= math.MaxUint16:
+		e.writeUint(0xda, n, 2)
+	default:
+		e.writeUint(0xdb, n, 4)
+	}
+	e.buf.WriteString(s)
+}
+
+func (e msgpackEncoder) encodeBinary(b []byte) {
+	n := uint64(len(b))
+	switch {
+	case n <= math.MaxUint8:
+		e.writeUint(0xc4, n, 1)
+	case n <= math.MaxUint16:
+		e.writeUint(0xc5, n, 2)
+	default:
+		e.writeUint(0xc6, n, 4)
+	}
+	e.buf.Write(b)
+}
+
+func (e msgpackEncoder) encodeArrayLen(n int) {
+	switch {
+	case n <= 15:
+		e.buf.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.writeUint(0xdc, uint64(n), 2)
+	default:
+		e.writeUint(0xdd, uint64(n), 4)
+	}
+}
+
+func (e msgpackEncoder) encodeMapLen(n int) {
+	switch {
+	case n <= 15:
+		e.buf.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.writeUint(0xde, uint64(n), 2)
+	default:
+		e.writeUint(0xdf, uint64(n), 4)
+	}
+}
+
+// encodeEventTime writes t as the Fluentd EventTime extension (type 0),
+// which keeps nanoseconds.
+func (e msgpackEncoder) encodeEventTime(t time.Time) {
+	var b [10]byte
+	b[0] = 0xd7 // fixext 8
+	b[1] = 0x00
+	binary.BigEndian.PutUint32(b[2:], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[6:], uint32(t.Nanosecond()))
+	e.buf.Write(b[:])
+}
+
+// encodeMap writes a string keyed map, with sorted keys so that the output
+// is stable.
+func (e msgpackEncoder) encodeMap(m map[string]interface{}) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	e.encodeMapLen(len(keys))
+	for _, k := range keys {
+		e.encodeString(k)
+		e.encode(m[k])
+	}
+}
+
+func (e msgpackEncoder) encode(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		e.encodeNil()
+	case bool:
+		e.encodeBool(v)
+	case string:
+		e.encodeString(v)
+	case []byte:
+		e.encodeBinary(v)
+	case int:
+		e.encodeInt(int64(v))
+	case int8:
+		e.encodeInt(int64(v))
+	case int16:
+		e.encodeInt(int64(v))
+	case int32:
+		e.encodeInt(int64(v))
+	case int64:
+		e.encodeInt(v)
+	case uint:
+		e.encodeUint(uint64(v))
+	case uint8:
+		e.encodeUint(uint64(v))
+	case uint16:
+		e.encodeUint(uint64(v))
+	case uint32:
+		e.encodeUint(uint64(v))
+	case uint64:
+		e.encodeUint(v)
+	case float32:
+		e.encodeFloat(float64(v))
+	case float64:
+		e.encodeFloat(v)
+	case time.Time:
+		e.encodeString(v.Format(time.RFC3339Nano))
+	case Fields:
+		e.encodeMap(v)
+	case map[string]interface{}:
+		e.encodeMap(v)
+	case []interface{}:
+		e.encodeArrayLen(len(v))
+		for _, item := range v {
+			e.encode(item)
+		}
+	case error:
+		e.encodeString(v.Error())
+	case fmt.Stringer:
+		e.encodeString(v.String())
+	default:
+		e.encodeReflect(reflect.ValueOf(v))
+	}
+}
+
+// encodeReflect handles named types and slices of other types than
+// interface{}, anything else is written as its fmt representation.
+func (e msgpackEncoder) encodeReflect(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		e.encodeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		e.encodeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.encodeFloat(v.Float())
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice, reflect.Array:
+		e.encodeArrayLen(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e.encode(v.Index(i).Interface())
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.encodeNil()
+			return
+		}
+		e.encode(v.Elem().Interface())
+	default:
+		e.encodeString(fmt.Sprint(v.Interface()))
+	}
+}
+
+type msgpackReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+var errMsgpackUnsupported = errors.New("galog: unsupported msgpack value")
+
+// decodeMsgpackStringMap decodes a map of strings, such as the ack
+// {"ack": "<chunk id>"} of a Fluentd server. Values of other types are
+// skipped.
+func decodeMsgpackStringMap(r msgpackReader) (map[string]string, error) {
+	n, err := decodeMsgpackMapLen(r)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k, err := decodeMsgpackString(r)
+		if err != nil {
+			return nil, err
+		}
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if !isMsgpackString(c) {
+			if err := skipMsgpack(r, c, 0); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		v, err := readMsgpackString(r, c)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func decodeMsgpackMapLen(r msgpackReader) (int, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), nil
+	case c == 0xde:
+		n, err := readMsgpackUint(r, 2)
+		return int(n), err
+	case c == 0xdf:
+		n, err := readMsgpackUint(r, 4)
+		return int(n), err
+	}
+	return 0, errMsgpackUnsupported
+}
+
+func decodeMsgpackString(r msgpackReader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	return readMsgpackString(r, c)
+}
+
+// isMsgpackString tells whether c starts a str or a bin value
+func isMsgpackString(c byte) bool {
+	return c&0xe0 == 0xa0 || (c >= 0xd9 && c <= 0xdb) || (c >= 0xc4 && c <= 0xc6)
+}
+
+// readMsgpackString reads the string or binary value started by c
+func readMsgpackString(r msgpackReader, c byte) (string, error) {
+	var n uint64
+	var err error
+	switch {
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c == 0xd9, c == 0xc4:
+		n, err = readMsgpackUint(r, 1)
+	case c == 0xda, c == 0xc5:
+		n, err = readMsgpackUint(r, 2)
+	case c == 0xdb, c == 0xc6:
+		n, err = readMsgpackUint(r, 4)
+	default:
+		return "", errMsgpackUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	if n > 1<<20 {
+		return "", errMsgpackUnsupported
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// how deep skipMsgpack follows nested arrays and maps
+const maxMsgpackDepth = 32
+
+// skipMsgpack reads past the value started by c
+func skipMsgpack(r msgpackReader, c byte, depth int) error {
+	if depth > maxMsgpackDepth {
+		return errMsgpackUnsupported
+	}
+
+	// bytes of payload, or values of an array or a map, following c
+	var size, values uint64
+	var err error
+	switch {
+	case c <= 0x7f, c >= 0xe0, c == 0xc0, c == 0xc2, c == 0xc3:
+		return nil
+	case c&0xf0 == 0x80:
+		values = 2 * uint64(c&0x0f)
+	case c&0xf0 == 0x90:
+		values = uint64(c & 0x0f)
+	case c&0xe0 == 0xa0:
+		size = uint64(c & 0x1f)
+	case c == 0xc4, c == 0xd9:
+		size, err = readMsgpackUint(r, 1)
+	case c == 0xc5, c == 0xda:
+		size, err = readMsgpackUint(r, 2)
+	case c == 0xc6, c == 0xdb:
+		size, err = readMsgpackUint(r, 4)
+	case c == 0xc7, c == 0xc8, c == 0xc9:
+		// ext: length, type, data
+		size, err = readMsgpackUint(r, 1<<(c-0xc7))
+		size++
+	case c == 0xca:
+		size = 4
+	case c == 0xcb:
+		size = 8
+	case c >= 0xcc && c <= 0xcf:
+		size = 1 << (c - 0xcc)
+	case c >= 0xd0 && c <= 0xd3:
+		size = 1 << (c - 0xd0)
+	case c >= 0xd4 && c <= 0xd8:
+		// fixext: type, data
+		size = 1 + 1<<(c-0xd4)
+	case c == 0xdc:
+		values, err = readMsgpackUint(r, 2)
+	case c == 0xdd:
+		values, err = readMsgpackUint(r, 4)
+	case c == 0xde:
+		values, err = readMsgpackUint(r, 2)
+		values *= 2
+	case c == 0xdf:
+		values, err = readMsgpackUint(r, 4)
+		values *= 2
+	default:
+		return errMsgpackUnsupported
+	}
+	if err != nil {
+		return err
+	}
+
+	if size > 0 {
+		if _, err := io.CopyN(ioutil.Discard, r, int64(size)); err != nil {
+			return err
+		}
+	}
+	for i := uint64(0); i < values; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if err := skipMsgpack(r, c, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readMsgpackUint(r msgpackReader, size int) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:size]); err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b[:size] {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
@@ -0,0 +1,190 @@
+package galog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDecodeMsgpack decodes any value written by msgpackEncoder: integers
+// as int64 or uint64, EventTime as time.Time
+func testDecodeMsgpack(r msgpackReader) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	readN := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	uintN := func(size int) uint64 {
+		v, _ := readMsgpackUint(r, size)
+		return v
+	}
+	array := func(n int) (interface{}, error) {
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = testDecodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	mapN := func(n int) (interface{}, error) {
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := decodeMsgpackString(r)
+			if err != nil {
+				return nil, err
+			}
+			if m[k], err = testDecodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return mapN(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return array(int(c & 0x0f))
+	case isMsgpackString(c):
+		return readMsgpackString(r, c)
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcb:
+		return math.Float64frombits(uintN(8)), nil
+	case 0xcc:
+		return uintN(1), nil
+	case 0xcd:
+		return uintN(2), nil
+	case 0xce:
+		return uintN(4), nil
+	case 0xcf:
+		return uintN(8), nil
+	case 0xd0:
+		return int64(int8(uintN(1))), nil
+	case 0xd1:
+		return int64(int16(uintN(2))), nil
+	case 0xd2:
+		return int64(int32(uintN(4))), nil
+	case 0xd3:
+		return int64(uintN(8)), nil
+	case 0xd7:
+		b, err := readN(9)
+		if err != nil || b[0] != 0 {
+			return nil, errors.New("not an EventTime")
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(b[1:])), int64(binary.BigEndian.Uint32(b[5:]))), nil
+	case 0xdc:
+		return array(int(uintN(2)))
+	case 0xdd:
+		return array(int(uintN(4)))
+	case 0xde:
+		return mapN(int(uintN(2)))
+	case 0xdf:
+		return mapN(int(uintN(4)))
+	}
+	return nil, fmt.Errorf("unexpected msgpack type 0x%x", c)
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 70000)
+	tests := []struct {
+		in   interface{}
+		want interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{0, int64(0)},
+		{127, int64(127)},
+		{200, uint64(200)},
+		{70000, uint64(70000)},
+		{uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{-1, int64(-1)},
+		{-100, int64(-100)},
+		{-40000, int64(-40000)},
+		{int64(math.MinInt64), int64(math.MinInt64)},
+		{1.5, 1.5},
+		{"short", "short"},
+		{strings.Repeat("y", 40), strings.Repeat("y", 40)},
+		{long, long},
+		{[]byte("bin"), "bin"},
+		{[]int{1, 2}, []interface{}{int64(1), int64(2)}},
+		{Fields{"a": "b"}, map[string]interface{}{"a": "b"}},
+		{errors.New("boom"), "boom"},
+		{WarnLevel, "warn"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		msgpackEncoder{&buf}.encode(tt.in)
+		got, err := testDecodeMsgpack(bufio.NewReader(&buf))
+		if err != nil {
+			t.Errorf("%T %.20v: %v", tt.in, tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%T %.20v: got %.20v", tt.in, tt.in, got)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%T %.20v: %d bytes left", tt.in, tt.in, buf.Len())
+		}
+	}
+}
+
+func TestMsgpackEventTime(t *testing.T) {
+	now := time.Unix(1585903230, 123456789)
+	var buf bytes.Buffer
+	msgpackEncoder{&buf}.encodeEventTime(now)
+	got, err := testDecodeMsgpack(bufio.NewReader(&buf))
+	if err != nil || !got.(time.Time).Equal(now) {
+		t.Fatalf("got %v, %v", got, err)
+	}
+}
+
+func TestDecodeMsgpackStringMapSkipsOtherValues(t *testing.T) {
+	var buf bytes.Buffer
+	msgpackEncoder{&buf}.encodeMap(map[string]interface{}{
+		"ack":    "chunk",
+		"count":  3,
+		"ratio":  0.5,
+		"nested": map[string]interface{}{"list": []interface{}{1, "two", nil}},
+		"ok":     true,
+		"none":   nil,
+		"zone":   "1",
+	})
+	// fixext 1 and ext 8 values, after a last key
+	b := buf.Bytes()
+	b[0] += 2
+	b = append(b, 0xa1, 'x', 0xd4, 1, 2)
+	b = append(b, 0xa1, 'y', 0xc7, 2, 5, 'a', 'b')
+
+	m, err := decodeMsgpackStringMap(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"ack": "chunk", "zone": "1"}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %v, want %v", m, want)
+	}
+}
@@ -0,0 +1,246 @@
+package galog
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// levelRegistry holds the level overrides of a logger tree, keyed by
+// logger name. It lives on the root logger.
+type levelRegistry struct {
+	mutex     sync.RWMutex
+	overrides map[string]Level
+	// pending SetLevelForDuration reverts, by name
+	reverts map[string]*levelRevert
+	// bumped on every change, so named loggers know their cached level is stale
+	gen uint32
+}
+
+type levelRevert struct {
+	timer   *time.Timer
+	restore func()
+}
+
+// cachedLevel is what a named logger remembers of its last lookup.
+type cachedLevel struct {
+	gen   uint32
+	found bool
+	level Level
+}
+
+// lookup returns the override of the longest prefix of name, prefixes are
+// taken on dot boundaries: "battle" matches "battle.skill" but not
+// "battleground".
+func (r *levelRegistry) lookup(name string) (Level, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for {
+		if level, ok := r.overrides[name]; ok {
+			return level, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return 0, false
+		}
+		name = name[:i]
+	}
+}
+
+func (r *levelRegistry) get(name string) (Level, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	level, ok := r.overrides[name]
+	return level, ok
+}
+
+func (r *levelRegistry) set(name string, level Level) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.overrides == nil {
+		r.overrides = make(map[string]Level)
+	}
+	r.overrides[name] = level
+	atomic.AddUint32(&r.gen, 1)
+}
+
+func (r *levelRegistry) clear(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.overrides, name)
+	atomic.AddUint32(&r.gen, 1)
+}
+
+// takeRevert cancels the pending revert of name and returns its restore
+// function, nil when there is none.
+func (r *levelRegistry) takeRevert(name string) func() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	rv, ok := r.reverts[name]
+	if !ok {
+		return nil
+	}
+	rv.timer.Stop()
+	delete(r.reverts, name)
+	return rv.restore
+}
+
+// scheduleRevert calls restore after d unless the revert is taken first.
+func (r *levelRegistry) scheduleRevert(name string, d time.Duration, restore func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.reverts == nil {
+		r.reverts = make(map[string]*levelRevert)
+	}
+	rv := &levelRevert{restore: restore}
+	rv.timer = time.AfterFunc(d, func() {
+		r.mutex.Lock()
+		current := r.reverts[name] == rv
+		if current {
+			delete(r.reverts, name)
+		}
+		r.mutex.Unlock()
+		if current {
+			restore()
+		}
+	})
+	r.reverts[name] = rv
+}
+
+func (r *levelRegistry) all() map[string]Level {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	levels := make(map[string]Level, len(r.overrides))
+	for name, level := range r.overrides {
+		levels[name] = level
+	}
+	return levels
+}
+
+// Named returns a child logger called name, or "parent.name" when the
+// parent is itself named, e.g. root.Named("battle").Named("skill") is
+// "battle.skill".
+//
+// The child writes to the output of its parent with the parent's formatter
+// unless given its own with SetOutput and SetFormatter, fires the hooks of
+// its parents, and logs at the level set for the longest matching name
+// prefix with SetLevelFor, or else at the level of the root logger.
+func (logger *Logger) Named(name string) *Logger {
+	if logger.name != "" {
+		name = logger.name + "." + name
+	}
+	return &Logger{
+		parent: logger,
+		name:   name,
+	}
+}
+
+// Name returns the name of the logger, empty for a root logger.
+func (logger *Logger) Name() string {
+	return logger.name
+}
+
+// SetLevelFor overrides the level of the named loggers called name or whose
+// name starts with name followed by a dot. An empty name sets the level of
+// the root logger itself.
+func (logger *Logger) SetLevelFor(name string, level Level) {
+	root := logger.root()
+	root.levels.takeRevert(name)
+	if name == "" {
+		root.SetLevel(level)
+		return
+	}
+	root.levels.set(name, level)
+}
+
+// ClearLevelFor removes the override set by SetLevelFor, loggers under name
+// go back to the next shorter prefix or the root level.
+func (logger *Logger) ClearLevelFor(name string) {
+	root := logger.root()
+	root.levels.takeRevert(name)
+	root.levels.clear(name)
+}
+
+// SetLevelForDuration sets the level like SetLevelFor and puts back the
+// previous one after d, so that debug logging turned on for a live server
+// can not be left on by accident. Calling it again before d has elapsed
+// extends the change, the level restored is still the one from before the
+// first call.
+func (logger *Logger) SetLevelForDuration(name string, level Level, d time.Duration) {
+	root := logger.root()
+	restore := root.levels.takeRevert(name)
+	if restore == nil {
+		restore = root.levelRestorer(name)
+	}
+	root.SetLevelFor(name, level)
+	root.levels.scheduleRevert(name, d, restore)
+}
+
+// levelRestorer captures the current level set for name.
+func (logger *Logger) levelRestorer(name string) func() {
+	if name == "" {
+		prev := logger.GetLevel()
+		return func() { logger.SetLevel(prev) }
+	}
+	prev, ok := logger.levels.get(name)
+	return func() {
+		if ok {
+			logger.levels.set(name, prev)
+		} else {
+			logger.levels.clear(name)
+		}
+	}
+}
+
+// LevelOverrides returns a copy of the levels set with SetLevelFor.
+func (logger *Logger) LevelOverrides() map[string]Level {
+	return logger.root().levels.all()
+}
+
+// namedLevel resolves the level of a named logger, the result of the lookup
+// is cached until the overrides change.
+func (logger *Logger) namedLevel() Level {
+	root := logger.root()
+	gen := atomic.LoadUint32(&root.levels.gen)
+	c, ok := logger.levelCache.Load().(cachedLevel)
+	if !ok || c.gen != gen {
+		c.gen = gen
+		c.level, c.found = root.levels.lookup(logger.name)
+		logger.levelCache.Store(c)
+	}
+	if c.found {
+		return c.level
+	}
+	return root.level()
+}
+
+func (logger *Logger) root() *Logger {
+	for logger.parent != nil {
+		logger = logger.parent
+	}
+	return logger
+}
+
+// mutex returns the lock shared by the whole logger tree
+func (logger *Logger) mutex() *MutexWrap {
+	return &logger.root().mu
+}
+
+func (logger *Logger) output() Handler {
+	for l := logger; l != nil; l = l.parent {
+		if l.Out != nil {
+			return l.Out
+		}
+	}
+	return nil
+}
+
+func (logger *Logger) formatter() Formatter {
+	for l := logger; l != nil; l = l.parent {
+		if l.Formatter != nil {
+			return l.Formatter
+		}
+	}
+	return nil
+}
@@ -0,0 +1,490 @@
+package galog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const otlpLogsPath = "/v1/logs"
+
+// OTLPOptions configures an OTLPHandler, zero values use the defaults.
+type OTLPOptions struct {
+	BatchOptions
+	RetryOptions
+
+	// ServiceName is the service.name resource attribute, the base name of
+	// os.Args[0] by default
+	ServiceName string
+
+	// ResourceAttributes describe the process, e.g. {"zone": 3}. host.name
+	// is added from os.Hostname() when missing.
+	ResourceAttributes Fields
+
+	// Protobuf sends requests encoded in protobuf instead of JSON
+	Protobuf bool
+
+	// Gzip compresses request bodies
+	Gzip bool
+
+	// Header is added to every request, e.g. for authentication
+	Header http.Header
+
+	// Client used for requests, http.DefaultClient by default
+	Client *http.Client
+
+	// ErrorHandler receives delivery errors, they are printed on os.Stderr
+	// by default.
+	ErrorHandler func(error)
+}
+
+// otlpRecord is a LogRecord waiting to be exported
+type otlpRecord struct {
+	traceID    []byte
+	spanID     []byte
+	time       time.Time
+	observed   time.Time
+	severity   int
+	level      string
+	body       string
+	attributes []otlpAttribute
+}
+
+type otlpAttribute struct {
+	key   string
+	value interface{}
+}
+
+// OTLPHandler exports logs to an OpenTelemetry collector with OTLP/HTTP.
+//
+// Entries become LogRecords: the severity number is mapped from the level,
+// the body is the formatted line, and the entry fields are attributes along
+// with the logger name, the event name and the caller. The trace_id and
+// span_id fields, see ContextWithTrace, fill the ids of the record.
+//
+// Records are sent in batches from a background goroutine, see
+// BatchOptions, and retried on the statuses the OTLP specification deems
+// retryable.
+type OTLPHandler struct {
+	sender       *httpSender
+	batcher      *batcher
+	resource     []otlpAttribute
+	protobuf     bool
+	errorHandler func(error)
+}
+
+// NewOTLPHandler return OTLPHandler exporting to the collector at url, e.g.
+// "http://otel-collector:4318"
+func NewOTLPHandler(url string, opts OTLPOptions) (*OTLPHandler, error) {
+	h := new(OTLPHandler)
+
+	resource := make(Fields, len(opts.ResourceAttributes)+2)
+	for k, v := range opts.ResourceAttributes {
+		resource[k] = v
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = filepath.Base(os.Args[0])
+	}
+	resource["service.name"] = opts.ServiceName
+	if _, ok := resource["host.name"]; !ok {
+		if host, err := os.Hostname(); err == nil {
+			resource["host.name"] = host
+		}
+	}
+	opts.BatchOptions.setDefaults()
+
+	h.sender = newHTTPSender(strings.TrimRight(url, "/")+otlpLogsPath, opts.Client, opts.Header, opts.Gzip, opts.RetryOptions)
+	h.sender.retryable = otlpRetryable
+	h.resource = otlpAttributes(resource)
+	h.protobuf = opts.Protobuf
+	h.errorHandler = opts.ErrorHandler
+	if h.errorHandler == nil {
+		h.errorHandler = defaultErrorHandler("Failed to export logs")
+	}
+	h.batcher = newBatcher(opts.BatchOptions, h.deliver)
+	h.batcher.drop = h.drop
+
+	return h, nil
+}
+
+// otlpRetryable follows the OTLP/HTTP specification: only 429, 502, 503 and
+// 504 are retried, besides network errors.
+func otlpRetryable(err error) bool {
+	switch e := err.(type) {
+	case *httpStatusError:
+		switch e.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	case *httpTransportError:
+		return true
+	}
+	return false
+}
+
+// otlpID takes a hex encoded id of size bytes out of fields, it is left in
+// place if it is not valid.
+func otlpID(fields Fields, key string, size int) []byte {
+	s, ok := fields[key].(string)
+	if !ok {
+		return nil
+	}
+	id, err := hex.DecodeString(s)
+	if err != nil || len(id) != size {
+		return nil
+	}
+	delete(fields, key)
+	return id
+}
+
+// otlpSeverity maps a galog level to an OpenTelemetry SeverityNumber
+func otlpSeverity(level Level) int {
+	switch level {
+	case TraceLevel:
+		return 1
+	case DebugLevel:
+		return 5
+	case InfoLevel:
+		return 9
+	case WarnLevel:
+		return 13
+	case ErrorLevel:
+		return 17
+	case FatalLevel:
+		return 21
+	default:
+		return 24
+	}
+}
+
+// otlpAttributes turns fields into attributes sorted by key
+func otlpAttributes(fields Fields) []otlpAttribute {
+	attrs := make([]otlpAttribute, 0, len(fields))
+	for k, v := range fields {
+		attrs = append(attrs, otlpAttribute{k, v})
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].key < attrs[j].key })
+	return attrs
+}
+
+// Write queues p as the body of an InfoLevel record
+func (h *OTLPHandler) Write(p []byte) (n int, err error) {
+	return h.WriteEntry(&Entry{Time: time.Now(), Level: InfoLevel}, p)
+}
+
+// attributes set from the entry, fields of the same name are renamed
+// "fields.<name>"
+var otlpAttributeNames = []string{"logger.name", "event.name", "code.filepath", "code.lineno", "code.function"}
+
+// WriteEntry queues a record made from the entry with p as its body
+func (h *OTLPHandler) WriteEntry(entry *Entry, p []byte) (n int, err error) {
+	r := h.record(entry, p)
+	if err := h.batcher.add(r, len(r.body)+32*len(r.attributes)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// record builds the LogRecord of an entry
+func (h *OTLPHandler) record(entry *Entry, p []byte) *otlpRecord {
+	fields := make(Fields, len(entry.Fields)+5)
+	for k, v := range entry.Fields {
+		fields[fieldKey(k, otlpAttributeNames)] = v
+	}
+	// ids extracted from the context go to the dedicated LogRecord fields
+	traceID, spanID := otlpID(fields, "trace_id", 16), otlpID(fields, "span_id", 8)
+	if entry.Name != "" {
+		fields["logger.name"] = entry.Name
+	}
+	if entry.Event != "" {
+		fields["event.name"] = entry.Event
+	}
+	if entry.Caller != nil {
+		fields["code.filepath"] = entry.Caller.File
+		fields["code.lineno"] = entry.Caller.Line
+		fields["code.function"] = entry.Caller.Function
+	}
+
+	return &otlpRecord{
+		traceID:    traceID,
+		spanID:     spanID,
+		time:       entry.Time,
+		observed:   time.Now(),
+		severity:   otlpSeverity(entry.Level),
+		level:      strings.ToUpper(entry.Level.String()),
+		body:       strings.TrimSuffix(string(p), "\n"),
+		attributes: otlpAttributes(fields),
+	}
+}
+
+func (h *OTLPHandler) deliver(items []interface{}) {
+	records := make([]*otlpRecord, len(items))
+	for i, item := range items {
+		records[i] = item.(*otlpRecord)
+	}
+	if err := h.export(records); err != nil {
+		h.errorHandler(err)
+	}
+}
+
+// export posts the records, retrying as configured. Records the collector
+// rejected are reported to the ErrorHandler, the error returned is for
+// those which could not be delivered.
+func (h *OTLPHandler) export(records []*otlpRecord) error {
+	if h.protobuf {
+		if _, err := h.sender.post(h.encodeProtobuf(records), "application/x-protobuf"); err != nil {
+			return fmt.Errorf("%d records lost, %v", len(records), err)
+		}
+		return nil
+	}
+
+	body, err := json.Marshal(h.encodeJSON(records))
+	if err == nil {
+		body, err = h.sender.post(body, "application/json")
+	}
+	if err != nil {
+		return fmt.Errorf("%d records lost, %v", len(records), err)
+	}
+
+	// the collector may accept only part of the records, they are not
+	// retried as per the specification
+	var resp struct {
+		PartialSuccess struct {
+			RejectedLogRecords json.Number `json:"rejectedLogRecords"`
+			ErrorMessage       string      `json:"errorMessage"`
+		} `json:"partialSuccess"`
+	}
+	if json.Unmarshal(body, &resp) == nil {
+		if n, _ := resp.PartialSuccess.RejectedLogRecords.Int64(); n > 0 {
+			h.errorHandler(fmt.Errorf("%d records rejected, %s", n, resp.PartialSuccess.ErrorMessage))
+		}
+	}
+	return nil
+}
+
+// WriteEntryBatch exports records right away, bypassing the queue, and
+// returns once they are delivered or retries ran out. A nil entry stands
+// for a record written with Write. It makes OTLPHandler an
+// EntryBatchWriter, to be used as the output of a SpoolHandler.
+func (h *OTLPHandler) WriteEntryBatch(entries []*Entry, records [][]byte) error {
+	batch := make([]*otlpRecord, len(records))
+	for i, p := range records {
+		entry := entries[i]
+		if entry == nil {
+			entry = &Entry{Time: time.Now(), Level: InfoLevel}
+		}
+		batch[i] = h.record(entry, p)
+	}
+	return h.export(batch)
+}
+
+// cancelBatch stops retrying, for SpoolHandler.Close
+func (h *OTLPHandler) cancelBatch() {
+	h.sender.close()
+}
+
+// encodeJSON builds an ExportLogsServiceRequest in the OTLP JSON encoding:
+// camelCase names, 64 bits integers as strings.
+func (h *OTLPHandler) encodeJSON(records []*otlpRecord) interface{} {
+	logRecords := make([]interface{}, len(records))
+	for i, r := range records {
+		lr := map[string]interface{}{
+			"timeUnixNano":         strconv.FormatInt(r.time.UnixNano(), 10),
+			"observedTimeUnixNano": strconv.FormatInt(r.observed.UnixNano(), 10),
+			"severityNumber":       r.severity,
+			"severityText":         r.level,
+			"body":                 otlpJSONValue(r.body),
+			"attributes":           otlpJSONAttributes(r.attributes),
+		}
+		if r.traceID != nil {
+			lr["traceId"] = hex.EncodeToString(r.traceID)
+		}
+		if r.spanID != nil {
+			lr["spanId"] = hex.EncodeToString(r.spanID)
+		}
+		logRecords[i] = lr
+	}
+
+	return map[string]interface{}{
+		"resourceLogs": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpJSONAttributes(h.resource),
+				},
+				"scopeLogs": []interface{}{
+					map[string]interface{}{
+						"scope":      map[string]interface{}{"name": "galog"},
+						"logRecords": logRecords,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpJSONAttributes(attrs []otlpAttribute) []interface{} {
+	kvs := make([]interface{}, len(attrs))
+	for i, a := range attrs {
+		kvs[i] = map[string]interface{}{
+			"key":   a.key,
+			"value": otlpJSONValue(a.value),
+		}
+	}
+	return kvs
+}
+
+// otlpJSONValue builds an AnyValue
+func otlpJSONValue(v interface{}) map[string]interface{} {
+	switch kind, value := otlpValue(v); kind {
+	case otlpBool:
+		return map[string]interface{}{"boolValue": value}
+	case otlpInt:
+		return map[string]interface{}{"intValue": strconv.FormatInt(value.(int64), 10)}
+	case otlpDouble:
+		// JSON has no NaN nor infinities, they would fail the whole batch
+		if f := value.(float64); math.IsNaN(f) || math.IsInf(f, 0) {
+			return map[string]interface{}{"stringValue": strconv.FormatFloat(f, 'g', -1, 64)}
+		}
+		return map[string]interface{}{"doubleValue": value}
+	default:
+		return map[string]interface{}{"stringValue": value}
+	}
+}
+
+// encodeProtobuf builds an ExportLogsServiceRequest:
+//
+//	ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+//	ResourceLogs { Resource resource = 1; repeated ScopeLogs scope_logs = 2; }
+//	Resource     { repeated KeyValue attributes = 1; }
+//	ScopeLogs    { InstrumentationScope scope = 1; repeated LogRecord log_records = 2; }
+//	LogRecord    { fixed64 time_unix_nano = 1; SeverityNumber severity_number = 2;
+//	               string severity_text = 3; AnyValue body = 5;
+//	               repeated KeyValue attributes = 6; bytes trace_id = 9;
+//	               bytes span_id = 10; fixed64 observed_time_unix_nano = 11; }
+func (h *OTLPHandler) encodeProtobuf(records []*otlpRecord) []byte {
+	var p protoBuffer
+	p.message(1, func(rl *protoBuffer) {
+		rl.message(1, func(res *protoBuffer) {
+			otlpProtoAttributes(res, 1, h.resource)
+		})
+		rl.message(2, func(sl *protoBuffer) {
+			sl.message(1, func(scope *protoBuffer) {
+				scope.string(1, "galog")
+			})
+			for _, r := range records {
+				sl.message(2, func(lr *protoBuffer) {
+					lr.fixed64(1, uint64(r.time.UnixNano()))
+					lr.uint64(2, uint64(r.severity))
+					lr.string(3, r.level)
+					lr.message(5, func(v *protoBuffer) {
+						otlpProtoValue(v, r.body)
+					})
+					otlpProtoAttributes(lr, 6, r.attributes)
+					lr.bytes(9, r.traceID)
+					lr.bytes(10, r.spanID)
+					lr.fixed64(11, uint64(r.observed.UnixNano()))
+				})
+			}
+		})
+	})
+	return p.b
+}
+
+// otlpProtoAttributes writes KeyValue { string key = 1; AnyValue value = 2; }
+func otlpProtoAttributes(p *protoBuffer, field int, attrs []otlpAttribute) {
+	for _, a := range attrs {
+		p.message(field, func(kv *protoBuffer) {
+			kv.string(1, a.key)
+			kv.message(2, func(v *protoBuffer) {
+				otlpProtoValue(v, a.value)
+			})
+		})
+	}
+}
+
+// otlpProtoValue writes the oneof of an AnyValue: string_value = 1,
+// bool_value = 2, int_value = 3, double_value = 4. Zero values are written
+// too, a oneof member is never omitted.
+func otlpProtoValue(p *protoBuffer, v interface{}) {
+	switch kind, value := otlpValue(v); kind {
+	case otlpBool:
+		p.tag(2, wireVarint)
+		if value.(bool) {
+			p.varint(1)
+		} else {
+			p.varint(0)
+		}
+	case otlpInt:
+		p.tag(3, wireVarint)
+		p.varint(uint64(value.(int64)))
+	case otlpDouble:
+		p.tag(4, wireFixed64)
+		bits := math.Float64bits(value.(float64))
+		for i := 0; i < 8; i++ {
+			p.b = append(p.b, byte(bits>>(8*i)))
+		}
+	default:
+		s := value.(string)
+		p.tag(1, wireBytes)
+		p.varint(uint64(len(s)))
+		p.b = append(p.b, s...)
+	}
+}
+
+const (
+	otlpString = iota
+	otlpBool
+	otlpInt
+	otlpDouble
+)
+
+// otlpValue classifies a field value for an AnyValue, anything but
+// booleans and numbers is sent as its string representation.
+func otlpValue(v interface{}) (int, interface{}) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return otlpBool, rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return otlpInt, rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return otlpInt, int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return otlpDouble, rv.Float()
+	case reflect.String:
+		return otlpString, rv.String()
+	}
+	if v == nil {
+		return otlpString, ""
+	}
+	return otlpString, fmt.Sprint(v)
+}
+
+// drop reports the records left when Close timed out
+func (h *OTLPHandler) drop(items []interface{}) {
+	h.errorHandler(fmt.Errorf("%d records dropped, handler closed", len(items)))
+}
+
+// Flush exports the queued records and waits for the request to complete
+func (h *OTLPHandler) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close exports the queued records, retrying as configured, and stops the
+// handler. It waits up to CloseTimeout, the records left are dropped.
+func (h *OTLPHandler) Close() error {
+	h.batcher.close()
+	h.sender.close()
+	return nil
+}
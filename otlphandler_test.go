@@ -0,0 +1,209 @@
+package galog
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOTLPHandlerJSON(t *testing.T) {
+	c := new(collector)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	var errs []error
+	h, err := NewOTLPHandler(srv.URL, OTLPOptions{
+		BatchOptions:       BatchOptions{FlushInterval: time.Hour},
+		ServiceName:        "game",
+		ResourceAttributes: Fields{"host.name": "zone3"},
+		ErrorHandler:       func(err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.WriteEntry(&Entry{
+		Time:  time.Unix(1, 5),
+		Level: WarnLevel,
+		Event: "roundflow",
+		Fields: Fields{
+			"trace_id":   "0102030405060708090a0b0c0d0e0f10",
+			"span_id":    "0102030405060708",
+			"zone_id":    3,
+			"ratio":      math.NaN(),
+			"event.name": "clash",
+		},
+	}, []byte("round\n"))
+	h.Close()
+
+	bodies := c.received()
+	if len(bodies) != 1 || len(errs) != 0 {
+		t.Fatalf("bodies %q, errors %v", bodies, errs)
+	}
+	if c.headers[0].Get("Content-Type") != "application/json" {
+		t.Errorf("content type %q", c.headers[0].Get("Content-Type"))
+	}
+	var req struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []map[string]interface{}
+			}
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano   string
+					SeverityNumber int
+					SeverityText   string
+					TraceID        string
+					SpanID         string
+					Body           map[string]interface{}
+					Attributes     []struct {
+						Key   string
+						Value map[string]interface{}
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &req); err != nil {
+		t.Fatal(err)
+	}
+	resource := req.ResourceLogs[0].Resource.Attributes
+	if len(resource) != 2 || resource[0]["key"] != "host.name" || resource[1]["key"] != "service.name" {
+		t.Errorf("resource %v", resource)
+	}
+	r := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if r.TimeUnixNano != "1000000005" || r.SeverityNumber != 13 || r.SeverityText != "WARN" {
+		t.Errorf("record %+v", r)
+	}
+	if r.TraceID != "0102030405060708090a0b0c0d0e0f10" || r.SpanID != "0102030405060708" {
+		t.Errorf("trace %q span %q", r.TraceID, r.SpanID)
+	}
+	if r.Body["stringValue"] != "round" {
+		t.Errorf("body %v", r.Body)
+	}
+	attrs := make(map[string]map[string]interface{})
+	for _, a := range r.Attributes {
+		attrs[a.Key] = a.Value
+	}
+	want := map[string]map[string]interface{}{
+		"event.name":        {"stringValue": "roundflow"},
+		"fields.event.name": {"stringValue": "clash"},
+		"zone_id":           {"intValue": "3"},
+		// JSON has no NaN, it is sent as a string
+		"ratio": {"stringValue": "NaN"},
+	}
+	if len(attrs) != len(want) {
+		t.Errorf("attributes %v", attrs)
+	}
+	for k, v := range want {
+		for vk, vv := range v {
+			if attrs[k][vk] != vv {
+				t.Errorf("%s = %v, want %v", k, attrs[k], v)
+			}
+		}
+	}
+}
+
+func TestOTLPHandlerProtobuf(t *testing.T) {
+	c := new(collector)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	h, _ := NewOTLPHandler(srv.URL+"/", OTLPOptions{Protobuf: true, Gzip: true})
+	h.WriteEntry(&Entry{
+		Time:   time.Unix(2, 0),
+		Level:  ErrorLevel,
+		Fields: Fields{"trace_id": "0102030405060708090a0b0c0d0e0f10"},
+	}, []byte("failed"))
+	h.Close()
+
+	bodies := c.received()
+	if len(bodies) != 1 || c.headers[0].Get("Content-Type") != "application/x-protobuf" {
+		t.Fatalf("bodies %q", bodies)
+	}
+	decode := func(b []byte) []protoField {
+		fields, err := testDecodeProto(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fields
+	}
+	resourceLogs := decode(protoGet(decode([]byte(bodies[0])), 1)[0].b)
+	scopeLogs := decode(protoGet(resourceLogs, 2)[0].b)
+	record := decode(protoGet(scopeLogs, 2)[0].b)
+
+	if f := protoGet(record, 1); len(f) != 1 || f[0].v != 2e9 {
+		t.Errorf("time %v", f)
+	}
+	if f := protoGet(record, 2); len(f) != 1 || f[0].v != 17 {
+		t.Errorf("severity %v", f)
+	}
+	if f := protoGet(record, 9); len(f) != 1 || len(f[0].b) != 16 || f[0].b[15] != 0x10 {
+		t.Errorf("trace id %v", f)
+	}
+	if f := protoGet(record, 10); len(f) != 0 {
+		t.Errorf("span id %v, want none", f)
+	}
+	body := decode(protoGet(record, 5)[0].b)
+	if f := protoGet(body, 1); len(f) != 1 || string(f[0].b) != "failed" {
+		t.Errorf("body %v", body)
+	}
+	// the trace id is not repeated as an attribute
+	if attrs := protoGet(record, 6); len(attrs) != 0 {
+		t.Errorf("attributes %v, want none", attrs)
+	}
+}
+
+func TestOTLPHandlerRetry(t *testing.T) {
+	// 500 is not retryable in OTLP, unlike 503
+	c := &collector{replies: []int{http.StatusServiceUnavailable, http.StatusInternalServerError}}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	var errs []error
+	h, _ := NewOTLPHandler(srv.URL, OTLPOptions{
+		RetryOptions: fastRetry,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	h.Write([]byte("lost"))
+	h.Close()
+
+	if bodies := c.received(); len(bodies) != 2 {
+		t.Fatalf("%d attempts, want 2", len(bodies))
+	}
+	if len(errs) != 1 {
+		t.Errorf("errors %v, want one", errs)
+	}
+}
+
+func TestOTLPHandlerCloseTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	errs := make(chan error, 2)
+	h, _ := NewOTLPHandler(srv.URL, OTLPOptions{
+		BatchOptions: BatchOptions{BatchSize: 1, CloseTimeout: 50 * time.Millisecond},
+		RetryOptions: RetryOptions{MaxRetries: 100, MinBackoff: time.Minute, MaxBackoff: time.Minute},
+		ErrorHandler: func(err error) { errs <- err },
+	})
+	h.Write([]byte("a"))
+	h.Write([]byte("b"))
+
+	start := time.Now()
+	h.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Close took %v", d)
+	}
+	// the record being retried is lost, the other one dropped
+	for i := 0; i < 2; i++ {
+		select {
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d errors reported, want 2", i)
+		}
+	}
+}
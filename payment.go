@@ -0,0 +1,162 @@
+package galog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PayStatus is the state of a recharge order, orders go through them in
+// this order, Refunded may follow Paid or Delivered.
+type PayStatus int
+
+const (
+	PayCreated   PayStatus = 1 // 下单
+	PayPaid      PayStatus = 2 // 支付成功，渠道回调到达
+	PayDelivered PayStatus = 3 // 已发货到角色
+	PayRefunded  PayStatus = 4 // 已退款
+)
+
+// ErrPayOutOfOrder is returned when logging a PayFlow whose status does not
+// follow the one last logged for the same order by this process.
+var ErrPayOutOfOrder = errors.New("galog: pay order status out of order")
+
+// PayFlow 充值流水，订单每次状态变化一条
+type PayFlow struct {
+	ZoneID         int       // 游戏区编号
+	EventTime      string    // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp      int64     // 时间戳，到毫秒，例如：1585903230000
+	GameID         int       // 游戏id
+	ChannelID      int       // 渠道ID，来源渠道配置表
+	AccountID      string    // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID         int       // 客户端平台 ios:2/android:1
+	CharID         string    // 角色id
+	CharName       string    // 角色名字 UTF-8编码
+	Level          int       // 角色触发当前事件时的等级
+	VipLevel       int       // 角色vip等级
+	OrderID        string    // 游戏订单号
+	ChannelOrderID string    // 渠道订单号，支付成功前可为空
+	Currency       string    // 币种，ISO 4217 代码，如 CNY/USD
+	Amount         int64     // 金额，币种的最小单位（如分），不使用浮点数
+	ProductID      string    // 商品ID
+	FirstPay       int       // 是否首充 1:是 0:否
+	Status         PayStatus // 订单状态 1:下单 2:支付成功 3:已发货 4:已退款
+	KvGroup        string    // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var payflowLogger *Logger
+
+// Log PayFlow 写日志
+func (p PayFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext PayFlow 写日志，附带 ctx 中的 trace_id 等字段。
+// 同一订单的状态必须按 下单→支付成功→已发货→(已退款) 逐个写入，重复或跳过的返回 ErrPayOutOfOrder 且不写日志；
+// 写入失败时不记录该状态，可以重试。OrderID 为空的不检查顺序
+func (p PayFlow) LogContext(ctx context.Context) error {
+	rollback, err := payOrders.transition(p.OrderID, p.Status)
+	if err != nil {
+		return err
+	}
+	err = payflowLogger.logEvent(ctx, "payflow", p, "PayFlow - %d|%s|%d|%d|%d|%s|%d|%s|%s|%d|%d|%s|%s|%s|%d|%s|%d|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.ChannelID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.VipLevel,
+		p.OrderID,
+		p.ChannelOrderID,
+		p.Currency,
+		p.Amount,
+		p.ProductID,
+		p.FirstPay,
+		p.Status,
+		p.KvGroup)
+	if err != nil {
+		rollback()
+	}
+	return err
+}
+
+// how long the status of an order is remembered after its last change
+const payOrderTTL = 24 * time.Hour
+
+// payOrderTracker remembers the last status logged for each order
+type payOrderTracker struct {
+	mutex  sync.Mutex
+	orders map[string]payOrder
+	// when orders was last swept of expired entries
+	swept time.Time
+}
+
+type payOrder struct {
+	status  PayStatus
+	updated time.Time
+}
+
+var payOrders payOrderTracker
+
+// transition records status for orderID, or returns ErrPayOutOfOrder if it
+// is not the one following the status last recorded: Created, Paid,
+// Delivered, then Refunded, none skipped. The first status seen for an order is
+// accepted whatever it is, the process may have been restarted since the
+// order was created. An empty orderID can not be told from another one, it
+// is not recorded.
+//
+// rollback forgets status again, for when the line could not be written,
+// unless another status was recorded since.
+func (t *payOrderTracker) transition(orderID string, status PayStatus) (rollback func(), err error) {
+	if status < PayCreated || status > PayRefunded {
+		return nil, fmt.Errorf("galog: invalid pay status %d", status)
+	}
+	if orderID == "" {
+		return func() {}, nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	if t.orders == nil {
+		t.orders = make(map[string]payOrder)
+		t.swept = now
+	}
+	if now.Sub(t.swept) > time.Minute {
+		for id, o := range t.orders {
+			if now.Sub(o.updated) > payOrderTTL {
+				delete(t.orders, id)
+			}
+		}
+		t.swept = now
+	}
+
+	last, ok := t.orders[orderID]
+	if ok && now.Sub(last.updated) <= payOrderTTL {
+		if status != last.status+1 {
+			return nil, fmt.Errorf("%w: order %s from %d to %d", ErrPayOutOfOrder, orderID, last.status, status)
+		}
+	}
+	recorded := payOrder{status, now}
+	t.orders[orderID] = recorded
+
+	return func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		if t.orders[orderID] != recorded {
+			return
+		}
+		if ok {
+			t.orders[orderID] = last
+		} else {
+			delete(t.orders, orderID)
+		}
+	}, nil
+}
@@ -0,0 +1,55 @@
+package galog
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPayFlowOrder(t *testing.T) {
+	saved := payflowLogger
+	defer func() { payflowLogger = saved }()
+	payflowLogger = New()
+	payOrders.mutex.Lock()
+	payOrders.orders = nil
+	payOrders.mutex.Unlock()
+
+	payflowLogger.SetOutput(failingHandler{})
+	order := PayFlow{OrderID: "order-1", Status: PayCreated}
+	if err := order.Log(); err == nil {
+		t.Fatal("write to a failing handler succeeded")
+	}
+
+	// the failed write is not recorded, the status can be logged again
+	payflowLogger.SetOutput(nopCloser{new(lockedBuffer)})
+	if err := order.Log(); err != nil {
+		t.Fatal(err)
+	}
+	if err := order.Log(); !errors.Is(err, ErrPayOutOfOrder) {
+		t.Errorf("repeated status returned %v, want ErrPayOutOfOrder", err)
+	}
+	order.Status = PayRefunded
+	if err := order.Log(); !errors.Is(err, ErrPayOutOfOrder) {
+		t.Errorf("refund before payment returned %v, want ErrPayOutOfOrder", err)
+	}
+	order.Status = PayDelivered
+	if err := order.Log(); !errors.Is(err, ErrPayOutOfOrder) {
+		t.Errorf("delivery before payment returned %v, want ErrPayOutOfOrder", err)
+	}
+	for _, status := range []PayStatus{PayPaid, PayDelivered, PayRefunded} {
+		order.Status = status
+		if err := order.Log(); err != nil {
+			t.Errorf("status %d: %v", status, err)
+		}
+	}
+
+	// orders without id are not tracked
+	anonymous := PayFlow{Status: PayPaid}
+	for i := 0; i < 2; i++ {
+		if err := anonymous.Log(); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, ok := payOrders.orders[""]; ok {
+		t.Error("empty order id tracked")
+	}
+}
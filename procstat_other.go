@@ -0,0 +1,18 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package galog
+
+import (
+	"time"
+)
+
+// procCPUTime is not available on this platform
+func procCPUTime() time.Duration {
+	return 0
+}
+
+// procRSS is not available on this platform
+func procRSS() int64 {
+	return 0
+}
@@ -0,0 +1,40 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package galog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// procCPUTime returns the user and system CPU time used by the process
+func procCPUTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// procRSS returns the resident set size of the process in bytes, 0 where
+// /proc is not available
+func procRSS() int64 {
+	b, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := bytes.Fields(b)
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * int64(os.Getpagesize())
+}
@@ -0,0 +1,186 @@
+package galog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TaskState 任务状态变化
+type TaskState int
+
+const (
+	TaskAccept   TaskState = 1 // 接取
+	TaskComplete TaskState = 2 // 完成
+	TaskAbandon  TaskState = 3 // 放弃
+)
+
+// TaskFlow 任务流水，任务每次状态变化一条
+type TaskFlow struct {
+	ZoneID    int       // 游戏区编号
+	EventTime string    // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp int64     // 时间戳，到毫秒，例如：1585903230000
+	GameID    int       // 游戏id
+	AccountID string    // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID    int       // 客户端平台 ios:2/android:1
+	CharID    string    // 角色id
+	CharName  string    // 角色名字 UTF-8编码
+	Level     int       // 角色触发当前事件时的等级
+	VipLevel  int       // 角色vip等级
+	TaskID    int       // 任务ID
+	TaskType  int       // 任务类型 1:主线 2:支线 3:日常 4:周常 5:活动 6:其他
+	State     TaskState // 状态 1:接取 2:完成 3:放弃
+	Duration  int       // 从接取到完成或放弃的时长(秒)，为 0 时由 sdk 根据本进程记录的接取时间填写
+	KvGroup   string    // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var taskflowLogger *Logger
+
+// Log TaskFlow 写日志
+func (p TaskFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext TaskFlow 写日志，附带 ctx 中的 trace_id 等字段
+func (p TaskFlow) LogContext(ctx context.Context) error {
+	key := progressKey{p.CharID, p.TaskID}
+	if p.State == TaskAccept {
+		taskAccepts.mark(key, eventTime(p.Timestamp))
+	} else if prev, ok := taskAccepts.take(key); ok && p.Duration == 0 {
+		p.Duration = secondsSince(prev, eventTime(p.Timestamp))
+	}
+	return taskflowLogger.logEvent(ctx, "taskflow", p, "TaskFlow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%d|%d|%d|%d|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.VipLevel,
+		p.TaskID,
+		p.TaskType,
+		p.State,
+		p.Duration,
+		p.KvGroup)
+}
+
+// GuideFlow 新手引导流水，每完成或跳过一步一条
+type GuideFlow struct {
+	ZoneID    int    // 游戏区编号
+	EventTime string // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp int64  // 时间戳，到毫秒，例如：1585903230000
+	GameID    int    // 游戏id
+	AccountID string // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID    int    // 客户端平台 ios:2/android:1
+	CharID    string // 角色id
+	CharName  string // 角色名字 UTF-8编码
+	Level     int    // 角色触发当前事件时的等级
+	GuideID   int    // 引导ID
+	Step      int    // 步骤序号
+	Skipped   int    // 是否跳过 1:是 0:否
+	SincePrev int    // 距同一引导上一步的时间(秒)，为 0 时由 sdk 根据本进程记录的上一步时间填写
+	KvGroup   string // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var guideflowLogger *Logger
+
+// Log GuideFlow 写日志
+func (p GuideFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext GuideFlow 写日志，附带 ctx 中的 trace_id 等字段
+func (p GuideFlow) LogContext(ctx context.Context) error {
+	t := eventTime(p.Timestamp)
+	if prev, ok := guideSteps.take(progressKey{p.CharID, p.GuideID}); ok && p.SincePrev == 0 {
+		p.SincePrev = secondsSince(prev, t)
+	}
+	guideSteps.mark(progressKey{p.CharID, p.GuideID}, t)
+	return guideflowLogger.logEvent(ctx, "guideflow", p, "GuideFlow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%d|%d|%d|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.GuideID,
+		p.Step,
+		p.Skipped,
+		p.SincePrev,
+		p.KvGroup)
+}
+
+// eventTime returns the time of an event from its Timestamp in
+// milliseconds, now if it is not set
+func eventTime(timestamp int64) time.Time {
+	if timestamp == 0 {
+		return time.Now()
+	}
+	return time.Unix(0, timestamp*int64(time.Millisecond))
+}
+
+// secondsSince returns the whole seconds from prev to t, 0 when the clock
+// of the server, or of the events, went backwards
+func secondsSince(prev time.Time, t time.Time) int {
+	if t.Before(prev) {
+		return 0
+	}
+	return int(t.Sub(prev) / time.Second)
+}
+
+// how long a task accept or a guide step is remembered, characters leave
+// tasks and guides unfinished
+const progressTTL = 7 * 24 * time.Hour
+
+type progressKey struct {
+	charID string
+	id     int
+}
+
+// progressTracker remembers, per character and task or guide, the time of
+// the last step logged by the process
+type progressTracker struct {
+	mutex sync.Mutex
+	marks map[progressKey]time.Time
+	// when marks was last swept of expired entries
+	swept time.Time
+}
+
+var (
+	taskAccepts progressTracker
+	guideSteps  progressTracker
+)
+
+func (t *progressTracker) mark(key progressKey, at time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	if t.marks == nil {
+		t.marks = make(map[progressKey]time.Time)
+		t.swept = now
+	}
+	if now.Sub(t.swept) > time.Hour {
+		for k, m := range t.marks {
+			if now.Sub(m) > progressTTL {
+				delete(t.marks, k)
+			}
+		}
+		t.swept = now
+	}
+	t.marks[key] = at
+}
+
+// take returns and forgets the time marked for key
+func (t *progressTracker) take(key progressKey) (time.Time, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	at, ok := t.marks[key]
+	delete(t.marks, key)
+	return at, ok
+}
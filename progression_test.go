@@ -0,0 +1,62 @@
+package galog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTaskFlowDuration(t *testing.T) {
+	duration := func(p TaskFlow) string {
+		line := eventLine(t, &taskflowLogger, p.Log)
+		return strings.Split(line, "|")[13]
+	}
+
+	if d := duration(TaskFlow{CharID: "duration", TaskID: 1, State: TaskAccept, Timestamp: 1000000}); d != "0" {
+		t.Errorf("duration %s on accept, want 0", d)
+	}
+	if d := duration(TaskFlow{CharID: "duration", TaskID: 1, State: TaskComplete, Timestamp: 1090500}); d != "90" {
+		t.Errorf("duration %s, want 90", d)
+	}
+	// the accept is forgotten once used
+	if d := duration(TaskFlow{CharID: "duration", TaskID: 1, State: TaskAbandon, Timestamp: 1100000}); d != "0" {
+		t.Errorf("duration %s without an accept, want 0", d)
+	}
+
+	duration(TaskFlow{CharID: "duration", TaskID: 2, State: TaskAccept, Timestamp: 1000000})
+	if d := duration(TaskFlow{CharID: "duration", TaskID: 2, State: TaskComplete, Timestamp: 1090000, Duration: 5}); d != "5" {
+		t.Errorf("duration %s, want the one given", d)
+	}
+
+	duration(TaskFlow{CharID: "duration", TaskID: 3, State: TaskAccept, Timestamp: 2000000})
+	if d := duration(TaskFlow{CharID: "duration", TaskID: 3, State: TaskComplete, Timestamp: 1990000}); d != "0" {
+		t.Errorf("duration %s with the clock going backwards, want 0", d)
+	}
+}
+
+func TestGuideFlowSincePrev(t *testing.T) {
+	sincePrev := func(p GuideFlow) string {
+		line := eventLine(t, &guideflowLogger, p.Log)
+		return strings.Split(line, "|")[12]
+	}
+
+	for _, c := range []struct {
+		step      int
+		timestamp int64
+		want      string
+	}{
+		{1, 1000000, "0"},  // first step
+		{2, 1030000, "30"}, // since step 1
+		{3, 1020000, "0"},  // the clock went backwards
+		{4, 1025000, "5"},  // since step 3
+	} {
+		p := GuideFlow{CharID: "sinceprev", GuideID: 1, Step: c.step, Timestamp: c.timestamp}
+		if got := sincePrev(p); got != c.want {
+			t.Errorf("step %d: since prev %s, want %s", c.step, got, c.want)
+		}
+	}
+
+	// steps of other guides do not count
+	if got := sincePrev(GuideFlow{CharID: "sinceprev", GuideID: 2, Step: 1, Timestamp: 1100000}); got != "0" {
+		t.Errorf("since prev %s for a new guide, want 0", got)
+	}
+}
@@ -0,0 +1,88 @@
+package galog
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Just enough of the protobuf wire format to encode the requests of the
+// Loki and OpenTelemetry handlers, without depending on generated code.
+// See https://protobuf.dev/programming-guides/encoding/
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+type protoBuffer struct {
+	b []byte
+}
+
+func (p *protoBuffer) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	p.b = append(p.b, buf[:n]...)
+}
+
+func (p *protoBuffer) tag(field int, wireType int) {
+	p.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint64 encodes int32, int64, uint64 and enum fields, zero is omitted as
+// in proto3
+func (p *protoBuffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, wireVarint)
+	p.varint(v)
+}
+
+func (p *protoBuffer) bool(field int, v bool) {
+	if v {
+		p.uint64(field, 1)
+	}
+}
+
+func (p *protoBuffer) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, wireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	p.b = append(p.b, buf[:]...)
+}
+
+func (p *protoBuffer) double(field int, v float64) {
+	p.fixed64(field, math.Float64bits(v))
+}
+
+func (p *protoBuffer) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(s)))
+	p.b = append(p.b, s...)
+}
+
+func (p *protoBuffer) bytes(field int, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(b)))
+	p.b = append(p.b, b...)
+}
+
+// message encodes a nested message written by fn, always present even when
+// empty.
+func (p *protoBuffer) message(field int, fn func(m *protoBuffer)) {
+	var m protoBuffer
+	fn(&m)
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(m.b)))
+	p.b = append(p.b, m.b...)
+}
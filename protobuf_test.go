@@ -0,0 +1,99 @@
+package galog
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// protoField is a field decoded by testDecodeProto, v holds varint and
+// fixed64 values, b length-delimited ones
+type protoField struct {
+	num  int
+	wire int
+	v    uint64
+	b    []byte
+}
+
+func testDecodeProto(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("invalid tag")
+		}
+		b = b[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			if f.v, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("invalid varint")
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errors.New("short fixed64")
+			}
+			f.v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errors.New("invalid length")
+			}
+			f.b, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return nil, errors.New("unexpected wire type")
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// protoGet returns the fields numbered num
+func protoGet(fields []protoField, num int) []protoField {
+	var found []protoField
+	for _, f := range fields {
+		if f.num == num {
+			found = append(found, f)
+		}
+	}
+	return found
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	var p protoBuffer
+	p.uint64(1, 300)
+	p.uint64(2, 0) // omitted
+	p.bool(3, true)
+	p.double(4, -1.25)
+	p.string(5, "hello")
+	p.bytes(6, []byte{0, 1})
+	p.message(7, func(m *protoBuffer) {
+		m.uint64(1, math.MaxUint64)
+	})
+	p.message(8, func(m *protoBuffer) {})
+
+	fields, err := testDecodeProto(p.b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []protoField{
+		{num: 1, wire: wireVarint, v: 300},
+		{num: 3, wire: wireVarint, v: 1},
+		{num: 4, wire: wireFixed64, v: math.Float64bits(-1.25)},
+		{num: 5, wire: wireBytes, b: []byte("hello")},
+		{num: 6, wire: wireBytes, b: []byte{0, 1}},
+	}
+	if !reflect.DeepEqual(fields[:5], want) {
+		t.Errorf("got %v, want %v", fields[:5], want)
+	}
+	nested, err := testDecodeProto(fields[5].b)
+	if err != nil || len(nested) != 1 || nested[0].v != math.MaxUint64 {
+		t.Errorf("nested message %v, %v", nested, err)
+	}
+	if f := fields[6]; f.num != 8 || len(f.b) != 0 {
+		t.Errorf("empty message %v, want present", f)
+	}
+}
@@ -0,0 +1,140 @@
+package galog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Reason codes shared by the events carrying a Reason, such as MoneyFlow
+// and ItemFlow, so that a code means the same thing in every report. Codes
+// below 100 are reserved for the ones defined here, teams register theirs
+// with RegisterReason.
+const (
+	ReasonUnknown  = 0  // 未知
+	ReasonGM       = 1  // GM/运营发放或扣除
+	ReasonRecharge = 2  // 充值
+	ReasonShop     = 3  // 商店购买
+	ReasonMail     = 4  // 邮件领取
+	ReasonTask     = 5  // 任务奖励
+	ReasonBattle   = 6  // 战斗掉落或消耗
+	ReasonTrade    = 7  // 玩家交易
+	ReasonCompose  = 8  // 合成/升级消耗
+	ReasonSell     = 9  // 出售
+	ReasonExpire   = 10 // 过期删除
+	ReasonActivity = 11 // 活动奖励
+	ReasonGacha    = 12 // 抽卡
+)
+
+// codes below it are reserved for the reasons defined by galog
+const reservedReasonCodes = 100
+
+// ErrUnknownReason is returned when logging an event whose reason was not
+// registered, once RequireRegisteredReasons is on.
+var ErrUnknownReason = errors.New("galog: unregistered reason code")
+
+var reasons = struct {
+	sync.RWMutex
+	names    map[int]string
+	codes    map[string]int
+	required bool
+}{
+	names: map[int]string{
+		ReasonUnknown:  "unknown",
+		ReasonGM:       "gm",
+		ReasonRecharge: "recharge",
+		ReasonShop:     "shop",
+		ReasonMail:     "mail",
+		ReasonTask:     "task",
+		ReasonBattle:   "battle",
+		ReasonTrade:    "trade",
+		ReasonCompose:  "compose",
+		ReasonSell:     "sell",
+		ReasonExpire:   "expire",
+		ReasonActivity: "activity",
+		ReasonGacha:    "gacha",
+	},
+}
+
+func init() {
+	reasons.codes = make(map[string]int, len(reasons.names))
+	for code, name := range reasons.names {
+		reasons.codes[name] = code
+	}
+}
+
+// RegisterReason registers code under name. Registering the same pair again
+// is a no-op, it is an error to register a code already taken by another
+// name, or a name already given to another code: two teams picked the same
+// code, or the same reason got two codes. Codes below 100 are reserved for
+// galog.
+func RegisterReason(code int, name string) error {
+	reasons.Lock()
+	defer reasons.Unlock()
+	if n, ok := reasons.names[code]; ok {
+		if n == name {
+			return nil
+		}
+		return fmt.Errorf("galog: reason code %d already registered as %q", code, n)
+	}
+	if code < reservedReasonCodes {
+		return fmt.Errorf("galog: reason code %d is reserved, codes below %d are galog's", code, reservedReasonCodes)
+	}
+	if c, ok := reasons.codes[name]; ok {
+		return fmt.Errorf("galog: reason %q already registered with code %d", name, c)
+	}
+	reasons.names[code] = name
+	reasons.codes[name] = code
+	return nil
+}
+
+// MustRegisterReason is like RegisterReason but panics on conflicts, for
+// declaring codes as package variables:
+//
+//	var ReasonArenaReward = galog.MustRegisterReason(1001, "arena_reward")
+func MustRegisterReason(code int, name string) int {
+	if err := RegisterReason(code, name); err != nil {
+		panic(err)
+	}
+	return code
+}
+
+// ReasonName returns the name code was registered with.
+func ReasonName(code int) (string, bool) {
+	reasons.RLock()
+	defer reasons.RUnlock()
+	name, ok := reasons.names[code]
+	return name, ok
+}
+
+// ReasonCodes returns the registered codes in order, e.g. to publish the
+// dictionary next to the reports.
+func ReasonCodes() []int {
+	reasons.RLock()
+	defer reasons.RUnlock()
+	codes := make([]int, 0, len(reasons.names))
+	for code := range reasons.names {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// RequireRegisteredReasons makes the events carrying a reason refuse, with
+// ErrUnknownReason, to log one which was not registered. Off by default.
+func RequireRegisteredReasons(on bool) {
+	reasons.Lock()
+	defer reasons.Unlock()
+	reasons.required = on
+}
+
+// checkReason returns ErrUnknownReason if code may not be logged
+func checkReason(code int) error {
+	reasons.RLock()
+	defer reasons.RUnlock()
+	if _, ok := reasons.names[code]; reasons.required && !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownReason, code)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package galog
+
+import "testing"
+
+func TestRegisterReason(t *testing.T) {
+	tests := []struct {
+		code    int
+		name    string
+		wantErr bool
+	}{
+		{ReasonShop, "shop", false}, // built-in registered again
+		{ReasonShop, "store", true}, // taken by the built-in
+		{50, "arena", true},         // reserved
+		{-1, "negative", true},      // reserved
+		{1001, "arena_reward", false},
+		{1001, "arena_reward", false},
+		{1002, "arena_reward", true}, // name given to 1001
+	}
+	for _, tt := range tests {
+		if err := RegisterReason(tt.code, tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("RegisterReason(%d, %q) = %v, want error %v", tt.code, tt.name, err, tt.wantErr)
+		}
+	}
+	if name, ok := ReasonName(1001); !ok || name != "arena_reward" {
+		t.Errorf("ReasonName(1001) = %q, %v", name, ok)
+	}
+}
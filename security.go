@@ -0,0 +1,246 @@
+package galog
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DetectType 检测类型
+type DetectType int
+
+const (
+	DetectRoundSpeed     DetectType = 1 // 对局时长与分数不符（加速）
+	DetectWinStreak      DetectType = 2 // 异常连胜
+	DetectFightPointJump DetectType = 3 // 战力突增
+	DetectClientReport   DetectType = 4 // 客户端反外挂上报
+	DetectServerCheck    DetectType = 5 // 服务器其他校验
+)
+
+// SecurityFlow 安全/反外挂流水，每次检测命中一条
+type SecurityFlow struct {
+	ZoneID     int        // 游戏区编号
+	EventTime  string     // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp  int64      // 时间戳，到毫秒，例如：1585903230000
+	GameID     int        // 游戏id
+	AccountID  string     // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID     int        // 客户端平台 ios:2/android:1
+	CharID     string     // 角色id
+	CharName   string     // 角色名字 UTF-8编码
+	Level      int        // 角色触发当前事件时的等级
+	DetectType DetectType // 检测类型 1:对局加速 2:异常连胜 3:战力突增 4:客户端上报 5:服务器校验
+	Score      int        // 可疑程度 0-100
+	RoundID    int        // 关联的对局 id，无则为 0
+	Evidence   string     // 证据，JSON
+	KvGroup    string     // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var securityflowLogger *Logger
+
+// Log SecurityFlow 写日志
+func (p SecurityFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext SecurityFlow 写日志，附带 ctx 中的 trace_id 等字段
+func (p SecurityFlow) LogContext(ctx context.Context) error {
+	return securityflowLogger.logEvent(ctx, "securityflow", p, "SecurityFlow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%d|%d|%d|%s|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.DetectType,
+		p.Score,
+		p.RoundID,
+		p.Evidence,
+		p.KvGroup)
+}
+
+// RoundflowRules are the thresholds of a RoundflowAnalyzer, a zero
+// threshold disables its rule.
+type RoundflowRules struct {
+	// MaxScorePerSecond flags rounds whose RoundScore / RoundTime is above
+	MaxScorePerSecond float64
+	// MinRoundTime flags won rounds shorter than it, in seconds
+	MinRoundTime int
+	// WinStreak flags a character winning that many rounds in a row, and
+	// every WinStreak more wins after
+	WinStreak int
+	// MaxFightPointGrowth flags a FightPoint more than that many times the
+	// one of the previous round of the character, e.g. 1.5
+	MaxFightPointGrowth float64
+}
+
+// RoundflowAnalyzer flags implausible rounds, see SetRoundflowAnalyzer. The
+// score of a SecurityFlow is 50 when the value is at the threshold, growing
+// with the ratio between them up to 100.
+type RoundflowAnalyzer struct {
+	// Rules apply to the rounds whose BattleType has no entry in
+	// ByBattleType
+	Rules        RoundflowRules
+	ByBattleType map[string]RoundflowRules
+
+	mutex sync.Mutex
+	chars map[string]*roundHistory
+	// when chars was last swept of characters not seen for a while
+	swept time.Time
+}
+
+// what the analyzer remembers of a character
+type roundHistory struct {
+	streak     int
+	fightPoint int
+	seen       time.Time
+}
+
+// how long the history of a character is kept after its last round
+const roundHistoryTTL = 24 * time.Hour
+
+var roundflowAnalyzer atomic.Value // *RoundflowAnalyzer
+
+// SetRoundflowAnalyzer makes Roundflow.Log run the rounds through a, and
+// log a SecurityFlow for each rule they break. Nil removes the analyzer.
+func SetRoundflowAnalyzer(a *RoundflowAnalyzer) {
+	roundflowAnalyzer.Store(a)
+}
+
+// analyzeRound logs the SecurityFlow records of the analyzer for p, if any
+func analyzeRound(ctx context.Context, p Roundflow) error {
+	a, _ := roundflowAnalyzer.Load().(*RoundflowAnalyzer)
+	if a == nil {
+		return nil
+	}
+	var errs MultiError
+	for _, s := range a.Analyze(p) {
+		if err := s.LogContext(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.err()
+}
+
+// Analyze returns the SecurityFlow records for the rules p breaks, and
+// records the round in the history of the character.
+func (a *RoundflowAnalyzer) Analyze(p Roundflow) []SecurityFlow {
+	rules := a.Rules
+	if r, ok := a.ByBattleType[p.BattleType]; ok {
+		rules = r
+	}
+
+	var flows []SecurityFlow
+	flag := func(t DetectType, value float64, threshold float64, evidence map[string]interface{}) {
+		evidence["round_time"] = p.RoundTime
+		evidence["round_score"] = p.RoundScore
+		evidence["battle_type"] = p.BattleType
+		evidence["battle_id"] = p.BattleID
+		b, _ := json.Marshal(evidence)
+		flows = append(flows, SecurityFlow{
+			ZoneID:     p.ZoneID,
+			EventTime:  p.EventTime,
+			Timestamp:  p.Timestamp,
+			GameID:     p.GameID,
+			AccountID:  p.AccountID,
+			PlatID:     p.PlatID,
+			CharID:     p.CharID,
+			CharName:   p.CharName,
+			Level:      p.Level,
+			DetectType: t,
+			Score:      detectScore(value, threshold),
+			RoundID:    p.RoundID,
+			Evidence:   string(b),
+		})
+	}
+
+	if rules.MaxScorePerSecond > 0 && p.RoundScore > 0 {
+		perSecond := math.Inf(1)
+		if p.RoundTime > 0 {
+			perSecond = float64(p.RoundScore) / float64(p.RoundTime)
+		}
+		if perSecond > rules.MaxScorePerSecond {
+			flag(DetectRoundSpeed, perSecond, rules.MaxScorePerSecond, map[string]interface{}{
+				"rule":                 "max_score_per_second",
+				"max_score_per_second": rules.MaxScorePerSecond,
+			})
+		}
+	}
+	if rules.MinRoundTime > 0 && p.Result == 1 && p.RoundTime < rules.MinRoundTime {
+		// the shorter the round, the higher the score
+		flag(DetectRoundSpeed, float64(rules.MinRoundTime), math.Max(float64(p.RoundTime), 1), map[string]interface{}{
+			"rule":           "min_round_time",
+			"min_round_time": rules.MinRoundTime,
+		})
+	}
+
+	a.mutex.Lock()
+	h := a.history(p.CharID)
+	if p.Result == 1 {
+		h.streak++
+	} else {
+		h.streak = 0
+	}
+	streak, fightPoint := h.streak, h.fightPoint
+	if p.FightPoint > 0 {
+		h.fightPoint = p.FightPoint
+	}
+	a.mutex.Unlock()
+
+	if rules.WinStreak > 0 && streak >= rules.WinStreak && streak%rules.WinStreak == 0 {
+		flag(DetectWinStreak, float64(streak), float64(rules.WinStreak), map[string]interface{}{
+			"rule":       "win_streak",
+			"win_streak": streak,
+			"threshold":  rules.WinStreak,
+		})
+	}
+	if rules.MaxFightPointGrowth > 0 && fightPoint > 0 &&
+		float64(p.FightPoint) > float64(fightPoint)*rules.MaxFightPointGrowth {
+		flag(DetectFightPointJump, float64(p.FightPoint)/float64(fightPoint), rules.MaxFightPointGrowth, map[string]interface{}{
+			"rule":                   "max_fight_point_growth",
+			"fight_point_before":     fightPoint,
+			"fight_point":            p.FightPoint,
+			"max_fight_point_growth": rules.MaxFightPointGrowth,
+		})
+	}
+
+	return flows
+}
+
+// history returns the history of a character, the mutex is held
+func (a *RoundflowAnalyzer) history(charID string) *roundHistory {
+	now := time.Now()
+	if a.chars == nil {
+		a.chars = make(map[string]*roundHistory)
+		a.swept = now
+	}
+	if now.Sub(a.swept) > time.Hour {
+		for id, h := range a.chars {
+			if now.Sub(h.seen) > roundHistoryTTL {
+				delete(a.chars, id)
+			}
+		}
+		a.swept = now
+	}
+	h, ok := a.chars[charID]
+	if !ok {
+		h = new(roundHistory)
+		a.chars[charID] = h
+	}
+	h.seen = now
+	return h
+}
+
+// detectScore maps value / threshold, from 1 up, to a score from 50 to 100
+func detectScore(value float64, threshold float64) int {
+	ratio := value / threshold
+	if math.IsInf(ratio, 1) || math.IsNaN(ratio) || ratio >= 2 {
+		return 100
+	}
+	return int(50 * ratio)
+}
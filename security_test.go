@@ -0,0 +1,78 @@
+package galog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoundflowAnalyzedOnceWritten(t *testing.T) {
+	savedRound, savedSecurity := roundflowLogger, securityflowLogger
+	defer func() {
+		roundflowLogger, securityflowLogger = savedRound, savedSecurity
+		SetRoundflowAnalyzer(nil)
+	}()
+	flows := new(lockedBuffer)
+	securityflowLogger = New()
+	securityflowLogger.SetFormatter(&TextFormatter{DisableFormat: true})
+	securityflowLogger.SetOutput(nopCloser{flows})
+	roundflowLogger = New()
+
+	a := &RoundflowAnalyzer{Rules: RoundflowRules{WinStreak: 2}}
+	SetRoundflowAnalyzer(a)
+	won := Roundflow{CharID: "c1", Result: 1, RoundTime: 60}
+
+	// a round missing from the files does not count in the streak
+	roundflowLogger.SetOutput(failingHandler{})
+	if err := won.Log(); err == nil {
+		t.Fatal("write to a failing handler succeeded")
+	}
+	roundflowLogger.SetOutput(nopCloser{new(lockedBuffer)})
+	if err := won.Log(); err != nil {
+		t.Fatal(err)
+	}
+	if flows.Len() != 0 {
+		t.Fatalf("streak flagged after one written round: %q", flows.String())
+	}
+
+	if err := won.Log(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(flows.String(), "SecurityFlow - ") {
+		t.Errorf("security flows %q, want the win streak", flows.String())
+	}
+}
+
+func TestRoundflowAnalyzerErrors(t *testing.T) {
+	savedRound, savedSecurity := roundflowLogger, securityflowLogger
+	defer func() {
+		roundflowLogger, securityflowLogger = savedRound, savedSecurity
+		SetRoundflowAnalyzer(nil)
+	}()
+	securityflowLogger = New()
+	securityflowLogger.SetOutput(failingHandler{})
+	roundflowLogger = New()
+	rounds := new(lockedBuffer)
+	roundflowLogger.SetOutput(nopCloser{rounds})
+	var errs []error
+	roundflowLogger.ErrorHandler = func(err error) { errs = append(errs, err) }
+
+	SetRoundflowAnalyzer(&RoundflowAnalyzer{Rules: RoundflowRules{WinStreak: 1}})
+	won := Roundflow{CharID: "c1", Result: 1, RoundTime: 60}
+
+	// the round is written, a failing SecurityFlow is not for the caller
+	// to retry
+	if err := won.Log(); err != nil {
+		t.Fatalf("error %v, want nil once the round is written", err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("errors handled %v, want the SecurityFlow one", errs)
+	}
+
+	// a round not logged is not analyzed
+	rounds.Reset()
+	errs = nil
+	roundflowLogger.SetLevel(WarnLevel)
+	if err := won.Log(); err != nil || rounds.Len() != 0 || len(errs) != 0 {
+		t.Errorf("disabled level: error %v, written %q, errors handled %v", err, rounds.String(), errs)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package galog
+
+import (
+	"errors"
+	"time"
+)
+
+// HandleLevelSignals is not supported on this platform, there is no
+// SIGUSR1/SIGUSR2. Use LevelHandler instead.
+func (logger *Logger) HandleLevelSignals(level Level, d time.Duration) (stop func(), err error) {
+	return nil, errors.New("galog: level signals are not supported on this platform")
+}
@@ -0,0 +1,55 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package galog
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// HandleLevelSignals switches the level of the logger on signals: SIGUSR1
+// raises it to level, SIGUSR2 puts back the level it had when
+// HandleLevelSignals was called. When d is positive the raised level is
+// also reverted automatically after d.
+//
+// The returned function stops listening for the signals, it may be called
+// more than once.
+func (logger *Logger) HandleLevelSignals(level Level, d time.Duration) (stop func(), err error) {
+	root := logger.root()
+	restore := root.levelRestorer(logger.name)
+
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for {
+			select {
+			case sig := <-c:
+				switch {
+				case sig == syscall.SIGUSR2:
+					root.levels.takeRevert(logger.name)
+					restore()
+				case d > 0:
+					root.SetLevelForDuration(logger.name, level, d)
+				default:
+					root.SetLevelFor(logger.name, level)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}, nil
+}
@@ -0,0 +1,32 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package galog
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleLevelSignals(t *testing.T) {
+	logger := New()
+	stop, err := logger.HandleLevelSignals(DebugLevel, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	deadline := time.Now().Add(5 * time.Second)
+	for !logger.IsLevelEnabled(DebugLevel) {
+		if time.Now().After(deadline) {
+			t.Fatal("level not raised on SIGUSR1")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stop()
+	// a second call must not panic
+	stop()
+}
@@ -0,0 +1,136 @@
+
+package galog
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// SlogHandler is a slog.Handler writing the records into a galog Logger:
+// through its hooks, formatter and output, at its level. The attributes of
+// a record are the fields of the entry, those of groups are keyed
+// "group.key".
+type SlogHandler struct {
+	logger *Logger
+	attrs  []slog.Attr
+	// prefix of the keys, the open groups joined by dots
+	group string
+}
+
+// NewSlogHandler returns a slog.Handler writing into logger, e.g.
+//
+//	slog.SetDefault(slog.New(galog.NewSlogHandler(logger)))
+func NewSlogHandler(logger *Logger) *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+// slogLevel maps a slog level to a galog Level, levels between those of
+// slog go to the lower galog one: slog.LevelDebug-1 is TraceLevel.
+func slogLevel(level slog.Level) Level {
+	switch {
+	case level >= slog.LevelError:
+		return ErrorLevel
+	case level >= slog.LevelWarn:
+		return WarnLevel
+	case level >= slog.LevelInfo:
+		return InfoLevel
+	case level >= slog.LevelDebug:
+		return DebugLevel
+	}
+	return TraceLevel
+}
+
+// Enabled implements slog.Handler.
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.IsLevelEnabled(slogLevel(level))
+}
+
+// Handle implements slog.Handler.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	logger := h.logger
+	if ctx != nil && ctx != context.Background() {
+		logger = logger.WithContext(ctx)
+	}
+	entry := logger.newEntry(slogLevel(r.Level), r.Message)
+	if !r.Time.IsZero() {
+		entry.Time = r.Time
+	}
+	if r.PC != 0 && logger.reportCaller() {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		entry.Caller = &frame
+	}
+	if entry.Fields == nil {
+		entry.Fields = make(Fields, len(h.attrs)+r.NumAttrs())
+	}
+	for _, a := range h.attrs {
+		addSlogAttr(entry.Fields, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addSlogAttr(entry.Fields, h.group, a)
+		return true
+	})
+	return logger.write(entry)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	h2.attrs = append(h2.attrs, h.attrs...)
+	for _, a := range attrs {
+		if h.group != "" {
+			// attrs are kept fully qualified, groups opened later do not
+			// apply to them
+			a = slog.Attr{Key: h.group + a.Key, Value: a.Value}
+		}
+		h2.attrs = append(h2.attrs, a)
+	}
+	return &h2
+}
+
+// WithGroup implements slog.Handler.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.group = h.group + name + "."
+	return &h2
+}
+
+// addSlogAttr adds a to fields, with group prefixed to its key. Groups are
+// flattened, empty attributes are left out as slog.Handler requires.
+func addSlogAttr(fields Fields, group string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		if a.Key != "" {
+			group += a.Key + "."
+		}
+		for _, ga := range attrs {
+			addSlogAttr(fields, group, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	var value interface{}
+	switch v.Kind() {
+	case slog.KindTime:
+		value = v.Time().Format(time.RFC3339Nano)
+	case slog.KindDuration:
+		value = v.Duration().String()
+	default:
+		value = v.Any()
+	}
+	fields[group+a.Key] = value
+}
@@ -0,0 +1,68 @@
+package galog
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSlogLevel(t *testing.T) {
+	for _, c := range []struct {
+		slog slog.Level
+		want Level
+	}{
+		{slog.LevelError + 4, ErrorLevel},
+		{slog.LevelError, ErrorLevel},
+		{slog.LevelWarn, WarnLevel},
+		{slog.LevelWarn - 1, InfoLevel},
+		{slog.LevelInfo, InfoLevel},
+		{slog.LevelDebug, DebugLevel},
+		{slog.LevelDebug - 1, TraceLevel},
+	} {
+		if got := slogLevel(c.slog); got != c.want {
+			t.Errorf("slogLevel(%v) = %v, want %v", c.slog, got, c.want)
+		}
+	}
+
+	logger := New()
+	h := NewSlogHandler(logger)
+	if h.Enabled(context.Background(), slog.LevelDebug) || !h.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("Enabled does not follow the level of the logger")
+	}
+}
+
+func TestSlogHandlerAttrs(t *testing.T) {
+	out := new(entryOutput)
+	logger := New()
+	logger.SetOutput(out)
+	l := slog.New(NewSlogHandler(logger)).With("a", 1).WithGroup("g").With("b", 2)
+
+	l.Warn("hello",
+		"c", 3,
+		slog.Group("sub", "d", 4),
+		slog.Group("empty"),
+		slog.Duration("dur", time.Second),
+	)
+	l.Debug("filtered")
+
+	if len(out.entries) != 1 {
+		t.Fatalf("%d entries", len(out.entries))
+	}
+	e := out.entries[0]
+	if e.Level != WarnLevel || e.Message != "hello" {
+		t.Errorf("entry %v %q", e.Level, e.Message)
+	}
+	want := Fields{"a": int64(1), "g.b": int64(2), "g.c": int64(3), "g.sub.d": int64(4), "g.dur": "1s"}
+	if len(e.Fields) != len(want) {
+		t.Fatalf("fields %v, want %v", e.Fields, want)
+	}
+	for k, v := range want {
+		if e.Fields[k] != v {
+			t.Errorf("field %s = %#v, want %#v", k, e.Fields[k], v)
+		}
+	}
+	if e.Caller == nil {
+		t.Error("no caller")
+	}
+}
@@ -0,0 +1,84 @@
+package galog
+
+import (
+	"encoding/binary"
+)
+
+// snappyEncode compresses src in the snappy block format, as expected by
+// the Loki push API. It is a plain greedy encoder: it finds fewer matches
+// than the reference one but its output decodes with any snappy decoder.
+// See https://github.com/google/snappy/blob/main/format_description.txt
+func snappyEncode(src []byte) []byte {
+	const (
+		tableBits = 14
+		maxOffset = 1<<16 - 1
+	)
+
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(src)))
+	dst := make([]byte, 0, n+len(src)+len(src)/60+8)
+	dst = append(dst, buf[:n]...)
+
+	// positions, plus one, of the last occurrence of 4 bytes sequences
+	var table [1 << tableBits]int32
+
+	lit := 0
+	for i := 0; i+4 <= len(src); {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := (v * 0x1e35a7bd) >> (32 - tableBits)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if cand < 0 || i-cand > maxOffset || binary.LittleEndian.Uint32(src[cand:]) != v {
+			i++
+			continue
+		}
+
+		dst = snappyLiteral(dst, src[lit:i])
+		length := 4
+		for i+length < len(src) && src[cand+length] == src[i+length] {
+			length++
+		}
+		dst = snappyCopy(dst, i-cand, length)
+		i += length
+		lit = i
+	}
+	return snappyLiteral(dst, src[lit:])
+}
+
+func snappyLiteral(dst []byte, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyCopy emits a copy of length bytes from offset bytes back, length
+// is at least 4.
+func snappyCopy(dst []byte, offset int, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 12 || offset >= 2048 {
+		return append(dst, byte(length-1)<<2|2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|1, byte(offset))
+}
@@ -0,0 +1,91 @@
+package galog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// testSnappyDecode decodes the snappy block format
+func testSnappyDecode(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errors.New("invalid length")
+	}
+	src = src[n:]
+	dst := make([]byte, 0, size)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			length = int(tag>>2) + 1
+			src = src[1:]
+			if extra := int(tag>>2) - 59; extra > 0 {
+				length = 1
+				for i := 0; i < extra; i++ {
+					length += int(src[i]) << (8 * uint(i))
+				}
+				src = src[extra:]
+			}
+			if length > len(src) {
+				return nil, errors.New("short literal")
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1:
+			length = int(tag>>2&7) + 4
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 2:
+			length = int(tag>>2) + 1
+			offset = int(src[1]) | int(src[2])<<8
+			src = src[3:]
+		case 3:
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, errors.New("invalid offset")
+		}
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, errors.New("length mismatch")
+	}
+	return dst, nil
+}
+
+func TestSnappyRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+	tests := map[string][]byte{
+		"empty":       {},
+		"short":       []byte("abc"),
+		"repeated":    bytes.Repeat([]byte("galog "), 20000),
+		"long run":    bytes.Repeat([]byte{'x'}, 1000),
+		"random":      random,
+		"far matches": append(append(append([]byte(nil), random[:5000]...), random[:70000]...), random[:5000]...),
+		"lines":       bytes.Repeat([]byte(`Playerlogin - 1|2020-04-03 16:40:30|1585903230000|1|2|1-33333|2|1000|name`+"\n"), 500),
+	}
+	for name, src := range tests {
+		encoded := snappyEncode(src)
+		got, err := testSnappyDecode(encoded)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, src) {
+			t.Errorf("%s: decoded %d bytes differ from the %d encoded", name, len(got), len(src))
+		}
+	}
+	if n := len(snappyEncode(tests["repeated"])); n > 10000 {
+		t.Errorf("repeated text compressed to %d bytes", n)
+	}
+}
@@ -0,0 +1,214 @@
+package galog
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ServerSnapshot 服务器快照，由 StartServerSnapshot 定时写入
+type ServerSnapshot struct {
+	ZoneID      int     // 游戏区编号
+	EventTime   string  // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp   int64   // 时间戳，到毫秒，例如：1585903230000
+	GameID      int     // 游戏id
+	OnlineCount int     // 当前在线角色数
+	CharCount   int64   // 本区已注册角色数，未提供时为 0
+	CPUPercent  float64 // 进程在上次快照以来的 CPU 占用，100 为占满一个核
+	RSS         int64   // 进程常驻内存(KB)，无法获取时为 0
+	Goroutines  int     // goroutine 数
+	GCCount     uint32  // 上次快照以来的 GC 次数
+	GCPause     int64   // 上次快照以来 GC 暂停的总时长(微秒)
+	KvGroup     string  // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var serversnapshotLogger *Logger
+
+// Log ServerSnapshot 写日志
+func (p ServerSnapshot) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext ServerSnapshot 写日志，附带 ctx 中的 trace_id 等字段
+func (p ServerSnapshot) LogContext(ctx context.Context) error {
+	return serversnapshotLogger.logEvent(ctx, "serversnapshot", p, "ServerSnapshot - %d|%s|%d|%d|%d|%d|%.1f|%d|%d|%d|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.OnlineCount,
+		p.CharCount,
+		p.CPUPercent,
+		p.RSS,
+		p.Goroutines,
+		p.GCCount,
+		p.GCPause,
+		p.KvGroup)
+}
+
+// SnapshotOptions configures StartServerSnapshot
+type SnapshotOptions struct {
+	ZoneID int
+	GameID int
+
+	// Interval between snapshots, defaults to one minute. Snapshots are
+	// taken on multiples of Interval, and at each rotation of the files.
+	Interval time.Duration
+
+	// Online returns the number of characters online, it is required.
+	Online func() int
+
+	// Registered returns the number of characters registered in the zone,
+	// optional.
+	Registered func() int64
+
+	// KvGroup returns the KvGroup of a snapshot, optional.
+	KvGroup func() string
+}
+
+// snapshotter is the goroutine started by StartServerSnapshot
+type snapshotter struct {
+	opts SnapshotOptions
+	stop chan struct{}
+	done chan struct{}
+	// file of serversnapshot, snapshots follow its rotation
+	file *TimeRotatingFileHandler
+
+	// at the previous snapshot
+	last    time.Time
+	cpu     time.Duration
+	numGC   uint32
+	pauseNs uint64
+}
+
+var (
+	snapshotMutex sync.Mutex
+	snapshots     *snapshotter
+)
+
+// StartServerSnapshot writes a ServerSnapshot every opts.Interval, and one
+// right away. It is also written when the files rotate, so each file starts
+// with one. Call it after Init, Clean stops it.
+func StartServerSnapshot(opts SnapshotOptions) error {
+	if opts.Online == nil {
+		return errors.New("galog: SnapshotOptions.Online is required")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+	if serversnapshotLogger == nil {
+		return errors.New("galog: StartServerSnapshot called before Init")
+	}
+	if snapshots != nil {
+		return errors.New("galog: server snapshot already started")
+	}
+
+	s := &snapshotter{
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		file: rotatingFile(serversnapshotLogger.Out),
+	}
+	s.log()
+	snapshots = s
+	go s.run()
+	return nil
+}
+
+// stopServerSnapshot stops the snapshots and waits for the goroutine
+func stopServerSnapshot() {
+	snapshotMutex.Lock()
+	s := snapshots
+	snapshots = nil
+	snapshotMutex.Unlock()
+	if s != nil {
+		close(s.stop)
+		<-s.done
+	}
+}
+
+func (s *snapshotter) run() {
+	defer close(s.done)
+	for {
+		timer := time.NewTimer(time.Until(s.next(time.Now())))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.log()
+		}
+	}
+}
+
+// rotatingFile returns the rotated file an event logger writes to, through
+// the MultiHandler set by AddOutput
+func rotatingFile(h Handler) *TimeRotatingFileHandler {
+	switch h := h.(type) {
+	case *TimeRotatingFileHandler:
+		return h
+	case *MultiHandler:
+		h.mutex.RLock()
+		defer h.mutex.RUnlock()
+		for _, d := range h.dests {
+			if f := rotatingFile(d.Handler); f != nil {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// next returns the time of the snapshot following now: the next multiple
+// of the interval, or the next rotation of the file if it comes first. A
+// rotation already due is left to the next snapshot, whose write rotates.
+func (s *snapshotter) next(now time.Time) time.Time {
+	next := now.Truncate(s.opts.Interval).Add(s.opts.Interval)
+	if s.file == nil {
+		return next
+	}
+	s.file.mutex.Lock()
+	rollover := time.Unix(s.file.rolloverAt, 0)
+	s.file.mutex.Unlock()
+	if rollover.After(now) && rollover.Before(next) {
+		next = rollover
+	}
+	return next
+}
+
+func (s *snapshotter) log() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	now, cpu := time.Now(), procCPUTime()
+
+	p := ServerSnapshot{
+		ZoneID:      s.opts.ZoneID,
+		EventTime:   now.Format("2006-01-02 15:04:05"),
+		Timestamp:   now.UnixNano() / int64(time.Millisecond),
+		GameID:      s.opts.GameID,
+		OnlineCount: s.opts.Online(),
+		RSS:         procRSS() / 1024,
+		Goroutines:  runtime.NumGoroutine(),
+		GCCount:     ms.NumGC - s.numGC,
+		GCPause:     int64(ms.PauseTotalNs-s.pauseNs) / int64(time.Microsecond),
+	}
+	if s.opts.Registered != nil {
+		p.CharCount = s.opts.Registered()
+	}
+	if s.opts.KvGroup != nil {
+		p.KvGroup = s.opts.KvGroup()
+	}
+	// the first snapshot has no CPU figure, its GC ones count from the start
+	if wall := now.Sub(s.last); !s.last.IsZero() && wall > 0 {
+		p.CPUPercent = float64(cpu-s.cpu) / float64(wall) * 100
+	}
+	s.last, s.cpu, s.numGC, s.pauseNs = now, cpu, ms.NumGC, ms.PauseTotalNs
+
+	if err := p.Log(); err != nil {
+		serversnapshotLogger.handleError(err)
+	}
+}
@@ -0,0 +1,29 @@
+package galog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotFollowsFileRotation(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 30, 0, time.Local)
+	file := &TimeRotatingFileHandler{rolloverAt: now.Add(10 * time.Second).Unix()}
+	multi, _ := NewMultiHandler(Destination{Handler: file, Sync: true})
+	s := &snapshotter{
+		opts: SnapshotOptions{Interval: time.Minute},
+		file: rotatingFile(multi),
+	}
+	if s.file != file {
+		t.Fatal("rotated file not found behind the MultiHandler")
+	}
+
+	// the rotation of the file, not one computed from now
+	if next := s.next(now); !next.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("next %v, want the rotation at %v", next, now.Add(10*time.Second))
+	}
+	// a rotation already due is done by the next snapshot
+	file.rolloverAt = now.Add(-time.Second).Unix()
+	if next := s.next(now); !next.Equal(now.Add(30 * time.Second)) {
+		t.Errorf("next %v, want the next minute", next)
+	}
+}
@@ -0,0 +1,244 @@
+package galog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"unicode/utf8"
+)
+
+// GuildAction 公会行为
+type GuildAction int
+
+const (
+	GuildCreate  GuildAction = 1 // 创建
+	GuildJoin    GuildAction = 2 // 加入
+	GuildLeave   GuildAction = 3 // 退出
+	GuildKick    GuildAction = 4 // 踢出成员
+	GuildDonate  GuildAction = 5 // 捐献
+	GuildDismiss GuildAction = 6 // 解散
+	GuildAppoint GuildAction = 7 // 任免职位
+)
+
+// FriendAction 好友行为
+type FriendAction int
+
+const (
+	FriendAdd     FriendAction = 1 // 添加
+	FriendRemove  FriendAction = 2 // 删除
+	FriendBlock   FriendAction = 3 // 拉黑
+	FriendUnblock FriendAction = 4 // 解除拉黑
+)
+
+// ChatChannel 聊天频道
+type ChatChannel int
+
+const (
+	ChatWorld   ChatChannel = 1 // 世界
+	ChatZone    ChatChannel = 2 // 本服
+	ChatGuild   ChatChannel = 3 // 公会
+	ChatTeam    ChatChannel = 4 // 队伍
+	ChatPrivate ChatChannel = 5 // 私聊
+)
+
+// GuildFlow 公会流水
+type GuildFlow struct {
+	ZoneID       int         // 游戏区编号
+	EventTime    string      // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp    int64       // 时间戳，到毫秒，例如：1585903230000
+	GameID       int         // 游戏id
+	AccountID    string      // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID       int         // 客户端平台 ios:2/android:1
+	CharID       string      // 角色id，行为的发起人
+	CharName     string      // 角色名字 UTF-8编码
+	Level        int         // 角色触发当前事件时的等级
+	GuildID      string      // 公会ID
+	GuildName    string      // 公会名字 UTF-8编码
+	Action       GuildAction // 行为 1:创建 2:加入 3:退出 4:踢出 5:捐献 6:解散 7:任免
+	Role         int         // 发起人在公会中的职位 1:会长 2:副会长 3:精英 4:成员
+	TargetCharID string      // 被踢出或被任免的角色id，其他行为为空
+	TargetRole   int         // 被任免后的职位，其他行为为 0
+	DonateType   int         // 捐献的货币或道具类型，非捐献为 0
+	DonateAmount int64       // 捐献数量，非捐献为 0
+	MemberCount  int         // 行为后的公会人数
+	KvGroup      string      // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var guildflowLogger *Logger
+
+// Log GuildFlow 写日志
+func (p GuildFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext GuildFlow 写日志，附带 ctx 中的 trace_id 等字段
+func (p GuildFlow) LogContext(ctx context.Context) error {
+	return guildflowLogger.logEvent(ctx, "guildflow", p, "GuildFlow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%s|%s|%d|%d|%s|%d|%d|%d|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.GuildID,
+		p.GuildName,
+		p.Action,
+		p.Role,
+		p.TargetCharID,
+		p.TargetRole,
+		p.DonateType,
+		p.DonateAmount,
+		p.MemberCount,
+		p.KvGroup)
+}
+
+// FriendFlow 好友流水
+type FriendFlow struct {
+	ZoneID          int          // 游戏区编号
+	EventTime       string       // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp       int64        // 时间戳，到毫秒，例如：1585903230000
+	GameID          int          // 游戏id
+	AccountID       string       // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID          int          // 客户端平台 ios:2/android:1
+	CharID          string       // 角色id
+	CharName        string       // 角色名字 UTF-8编码
+	Level           int          // 角色触发当前事件时的等级
+	Action          FriendAction // 行为 1:添加 2:删除 3:拉黑 4:解除拉黑
+	TargetAccountID string       // 对方账号ID
+	TargetCharID    string       // 对方角色id
+	FriendCount     int          // 行为后的好友数
+	KvGroup         string       // 扩展字段，一个或多个KeyValue的JSON字符串
+}
+
+var friendflowLogger *Logger
+
+// Log FriendFlow 写日志
+func (p FriendFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext FriendFlow 写日志，附带 ctx 中的 trace_id 等字段
+func (p FriendFlow) LogContext(ctx context.Context) error {
+	return friendflowLogger.logEvent(ctx, "friendflow", p, "FriendFlow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%d|%s|%s|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.Action,
+		p.TargetAccountID,
+		p.TargetCharID,
+		p.FriendCount,
+		p.KvGroup)
+}
+
+// ChatFlow 聊天流水，只记录消息的哈希和长度，原文见 EnableChatText
+type ChatFlow struct {
+	ZoneID    int         // 游戏区编号
+	EventTime string      // 游戏事件的时间, 格式 YYYY-MM-DD HH:MM:SS
+	Timestamp int64       // 时间戳，到毫秒，例如：1585903230000
+	GameID    int         // 游戏id
+	AccountID string      // 账号ID，按照平台统一规则，与客户端sdk的openid一致，比如1-33333
+	PlatID    int         // 客户端平台 ios:2/android:1
+	CharID    string      // 角色id
+	CharName  string      // 角色名字 UTF-8编码
+	Level     int         // 角色触发当前事件时的等级
+	ClientIP  string      // 客户端IP地址
+	Channel   ChatChannel // 频道 1:世界 2:本服 3:公会 4:队伍 5:私聊
+	TargetID  string      // 私聊为对方角色id，公会、队伍频道为公会ID、队伍ID，其他为空
+	MsgHash   string      // 消息原文 UTF-8 编码的 HMAC-SHA256（十六进制），为空时由 sdk 根据 Text 计算，见 SetChatHashKey
+	MsgLen    int         // 消息长度（字符数），为 0 时由 sdk 根据 Text 计算
+	KvGroup   string      // 扩展字段，一个或多个KeyValue的JSON字符串
+	// Text 消息原文，不写入 chatflow，开启 EnableChatText 后写入 chattext
+	Text string
+}
+
+var (
+	chatflowLogger *Logger
+
+	chattextLogger  *Logger
+	chatTextEnabled bool
+	chatHashKey     []byte
+)
+
+// SetChatHashKey sets the HMAC-SHA256 key of the MsgHash of ChatFlow. A
+// plain hash of a short message is reversed by hashing likely messages, the
+// key keeps it to those holding it. Without a key, or for a message without
+// Text, MsgHash is left as given. Call it before logging.
+func SetChatHashKey(key []byte) {
+	chatHashKey = append([]byte(nil), key...)
+}
+
+// chatHash returns the hex HMAC of a message text
+func chatHash(key []byte, text string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(text))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// EnableChatText makes Init open the chattext files, where the raw text of
+// ChatFlow messages is written next to their hash. Only the account running
+// the server may read them (0600), and they are not sent to the outputs
+// added by AddOutput. Call it before Init, along with SetChatHashKey: the
+// hash joins the chattext lines to chatflow, Init fails without a key.
+func EnableChatText(on bool) {
+	chatTextEnabled = on
+}
+
+// Log ChatFlow 写日志
+func (p ChatFlow) Log() error {
+	return p.LogContext(context.Background())
+}
+
+// LogContext ChatFlow 写日志，附带 ctx 中的 trace_id 等字段
+func (p ChatFlow) LogContext(ctx context.Context) error {
+	if p.MsgHash == "" && p.Text != "" && len(chatHashKey) > 0 {
+		p.MsgHash = chatHash(chatHashKey, p.Text)
+	}
+	if p.MsgLen == 0 {
+		p.MsgLen = utf8.RuneCountInString(p.Text)
+	}
+	text := p.Text
+	// the text must only reach the restricted file
+	p.Text = ""
+
+	if err := chatflowLogger.logEvent(ctx, "chatflow", p, "ChatFlow - %d|%s|%d|%d|%s|%d|%s|%s|%d|%s|%d|%s|%s|%d|%s\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.GameID,
+		p.AccountID,
+		p.PlatID,
+		p.CharID,
+		p.CharName,
+		p.Level,
+		p.ClientIP,
+		p.Channel,
+		p.TargetID,
+		p.MsgHash,
+		p.MsgLen,
+		p.KvGroup); err != nil {
+		return err
+	}
+	if chattextLogger == nil || text == "" {
+		return nil
+	}
+	// quoted, so that the text stays on one line whatever it contains
+	return chattextLogger.logEvent(ctx, "chattext", nil, "ChatText - %d|%s|%d|%s|%d|%s|%s|%q\n",
+		p.ZoneID,
+		p.EventTime,
+		p.Timestamp,
+		p.CharID,
+		p.Channel,
+		p.TargetID,
+		p.MsgHash,
+		text)
+}
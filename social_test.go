@@ -0,0 +1,86 @@
+package galog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatFlowMsgHash(t *testing.T) {
+	saved, savedKey := chatflowLogger, chatHashKey
+	defer func() { chatflowLogger, chatHashKey = saved, savedKey }()
+	out := new(lockedBuffer)
+	chatflowLogger = New()
+	chatflowLogger.SetFormatter(&TextFormatter{DisableFormat: true})
+	chatflowLogger.SetOutput(nopCloser{out})
+
+	msgHash := func(p ChatFlow) string {
+		out.Reset()
+		if err := p.Log(); err != nil {
+			t.Fatal(err)
+		}
+		columns := strings.Split(strings.TrimSuffix(out.String(), "\n"), "|")
+		return columns[12]
+	}
+
+	// only without chattext, which Init refuses to open without a key
+	chatHashKey = nil
+	if h := msgHash(ChatFlow{Text: "hello"}); h != "" {
+		t.Errorf("hash %q without a key, want none", h)
+	}
+
+	SetChatHashKey([]byte("secret"))
+	// HMAC-SHA256("secret", "hello")
+	want := "88aab3ede8d3adf94d26ab90d3bafd4a2083070c3bcce9c014ee04a443847c0b"
+	if h := msgHash(ChatFlow{Text: "hello"}); h != want {
+		t.Errorf("hash %q, want %q", h, want)
+	}
+	if h := msgHash(ChatFlow{}); h != "" {
+		t.Errorf("hash %q of an empty text, want none", h)
+	}
+	if h := msgHash(ChatFlow{Text: "hello", MsgHash: "given"}); h != "given" {
+		t.Errorf("hash %q, want the one given", h)
+	}
+}
+
+func TestChatTextRequiresHashKey(t *testing.T) {
+	savedKey := chatHashKey
+	defer func() {
+		chatHashKey = savedKey
+		EnableChatText(false)
+	}()
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	EnableChatText(true)
+	chatHashKey = nil
+	if err := Init(dir, WhenDay, 1); err == nil {
+		Clean()
+		t.Fatal("Init opened chattext without a hash key")
+	}
+
+	SetChatHashKey([]byte("secret"))
+	if err := Init(dir, WhenDay, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer Clean()
+	if err := (ChatFlow{CharID: "c1", Text: "hi"}).Log(); err != nil {
+		t.Fatal(err)
+	}
+	flushEvents()
+
+	// the chattext line carries the MsgHash of the chatflow one
+	hash := chatHash([]byte("secret"), "hi")
+	for _, ident := range []string{"chatflow", "chattext"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, ident+"."+time.Now().Format("2006-01-02")))
+		if err != nil || !strings.Contains(string(b), "|"+hash+"|") {
+			t.Errorf("%s %q, %v", ident, b, err)
+		}
+	}
+}
@@ -0,0 +1,821 @@
+package galog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSegmentBytes = 16 << 20
+	defaultSpoolBytes   = 1 << 30
+	spoolHeaderSize     = 8
+	spoolSegmentExt     = ".seg"
+	spoolAckFile        = "ack"
+	defaultSpoolBatch   = 500
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrSpoolClosed is returned by Spool methods once it is closed
+var ErrSpoolClosed = errors.New("galog: spool is closed")
+
+// SpoolPolicy decides what Spool.Append does when the spool is full
+type SpoolPolicy int
+
+const (
+	// DropOldest deletes the oldest segment, undelivered or not, to make room
+	DropOldest SpoolPolicy = iota
+	// Block waits until enough records are acknowledged
+	Block
+)
+
+// SpoolOptions configures a Spool, zero values use the defaults.
+type SpoolOptions struct {
+	// SegmentBytes is the size after which a new segment file is started,
+	// 16MiB by default
+	SegmentBytes int64
+
+	// MaxBytes caps the size of all segment files together, 1GiB by default
+	MaxBytes int64
+
+	// Policy when MaxBytes is reached, DropOldest by default
+	Policy SpoolPolicy
+
+	// Sync commits every appended record to stable storage, instead of
+	// leaving it to the operating system
+	Sync bool
+}
+
+// spoolPos is a position in the spool: a segment id and a byte offset in it
+type spoolPos struct {
+	seg int64
+	off int64
+}
+
+// Spool is a durable on-disk queue of records, for handlers shipping logs
+// to a remote service that may be down for a while.
+//
+// Records are appended to segment files in dir, each prefixed by its length
+// and CRC. The consumer reads them in order with Read and calls Ack once
+// they are delivered; the acknowledged position is persisted so that
+// unacknowledged records are read again after a restart, and segments read
+// and acknowledged entirely are deleted.
+//
+// A Spool has a single consumer.
+type Spool struct {
+	dir  string
+	opts SpoolOptions
+
+	segments []int64 // ids of the segment files, oldest first
+	sizes    map[int64]int64
+	total    int64
+
+	w      *os.File // last segment, appended to
+	r      *os.File // segment being read
+	rSeg   int64    // segment r was opened for
+	read   spoolPos // position after the last record returned by Read
+	acked  spoolPos // position persisted by Ack
+	closed bool
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+}
+
+// OpenSpool opens the spool in dir, creating it if needed, and resumes from
+// the last acknowledged position.
+func OpenSpool(dir string, opts SpoolOptions) (*Spool, error) {
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultSpoolBytes
+	}
+	if opts.SegmentBytes > opts.MaxBytes {
+		opts.SegmentBytes = opts.MaxBytes
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	s := new(Spool)
+	s.dir = dir
+	s.opts = opts
+	s.sizes = make(map[int64]int64)
+	s.cond = sync.NewCond(&s.mutex)
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), spoolSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, id)
+		s.sizes[id] = f.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	s.acked, err = s.loadAck()
+	if err != nil {
+		return err
+	}
+	for len(s.segments) > 0 && s.segments[0] < s.acked.seg {
+		if err := s.removeOldest(); err != nil {
+			return err
+		}
+	}
+
+	if len(s.segments) == 0 {
+		s.segments = []int64{s.acked.seg}
+		s.sizes[s.acked.seg] = 0
+	}
+	if s.segments[0] != s.acked.seg {
+		s.acked = spoolPos{seg: s.segments[0]}
+	}
+	s.read = s.acked
+
+	// a crash may have left a partial record at the end of the last segment
+	last := s.segments[len(s.segments)-1]
+	size, err := s.validLength(last)
+	if err != nil {
+		return err
+	}
+	s.sizes[last] = size
+	if s.w, err = os.OpenFile(s.segmentPath(last), os.O_CREATE|os.O_WRONLY, 0666); err != nil {
+		return err
+	}
+	if err := s.w.Truncate(size); err != nil {
+		return err
+	}
+	if _, err := s.w.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+
+	for _, id := range s.segments {
+		s.total += s.sizes[id]
+	}
+	return nil
+}
+
+func (s *Spool) loadAck() (spoolPos, error) {
+	var pos spoolPos
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, spoolAckFile))
+	if os.IsNotExist(err) {
+		if len(s.segments) > 0 {
+			pos.seg = s.segments[0]
+		}
+		return pos, nil
+	}
+	if err != nil {
+		return pos, err
+	}
+	if _, err := fmt.Sscanf(string(b), "%d %d", &pos.seg, &pos.off); err != nil {
+		return pos, fmt.Errorf("invalid spool ack file: %v", err)
+	}
+	return pos, nil
+}
+
+// saveAck persists the acknowledged position, through a rename so that it
+// is never seen half written.
+func (s *Spool) saveAck() error {
+	tmp := filepath.Join(s.dir, spoolAckFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d %d\n", s.acked.seg, s.acked.off); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, spoolAckFile)); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+// syncDir commits the entries of dir, such as a rename, to stable storage.
+// Windows can not sync directories, its renames are left as they are.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && runtime.GOOS != "windows" {
+		return err
+	}
+	return nil
+}
+
+// validLength returns the length of the complete, uncorrupted records at the
+// start of a segment.
+func (s *Spool) validLength(id int64) (int64, error) {
+	f, err := os.Open(s.segmentPath(id))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var off int64
+	for {
+		_, n, err := readRecord(f, off, s.sizes[id])
+		if err != nil {
+			return off, nil
+		}
+		off += n
+	}
+}
+
+func (s *Spool) segmentPath(id int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, spoolSegmentExt))
+}
+
+// readRecord reads the record at off, limit is the end of the valid data.
+func readRecord(f *os.File, off int64, limit int64) ([]byte, int64, error) {
+	if off+spoolHeaderSize > limit {
+		return nil, 0, io.EOF
+	}
+	var header [spoolHeaderSize]byte
+	if _, err := f.ReadAt(header[:], off); err != nil {
+		return nil, 0, err
+	}
+	length := int64(binary.LittleEndian.Uint32(header[0:4]))
+	sum := binary.LittleEndian.Uint32(header[4:8])
+	if off+spoolHeaderSize+length > limit {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, length)
+	if _, err := f.ReadAt(data, off+spoolHeaderSize); err != nil {
+		return nil, 0, err
+	}
+	if crc32.Checksum(data, crcTable) != sum {
+		return nil, 0, errors.New("galog: spool record checksum mismatch")
+	}
+	return data, spoolHeaderSize + length, nil
+}
+
+// Append adds a record at the end of the spool.
+func (s *Spool) Append(p []byte) error {
+	record := make([]byte, spoolHeaderSize+len(p))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(p)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(p, crcTable))
+	copy(record[spoolHeaderSize:], p)
+	size := int64(len(record))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for !s.closed && s.total+size > s.opts.MaxBytes && s.total > 0 {
+		if s.opts.Policy == Block && !s.allAcked() {
+			s.cond.Wait()
+			continue
+		}
+		if len(s.segments) == 1 {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+		if err := s.removeOldest(); err != nil {
+			return err
+		}
+	}
+	if s.closed {
+		return ErrSpoolClosed
+	}
+
+	last := s.lastSegment()
+	if s.sizes[last] > 0 && s.sizes[last]+size > s.opts.SegmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		last = s.lastSegment()
+	}
+
+	if _, err := s.w.Write(record); err != nil {
+		return err
+	}
+	if s.opts.Sync {
+		if err := s.w.Sync(); err != nil {
+			return err
+		}
+	}
+	s.sizes[last] += size
+	s.total += size
+	s.cond.Broadcast()
+	return nil
+}
+
+func (s *Spool) lastSegment() int64 {
+	return s.segments[len(s.segments)-1]
+}
+
+func (s *Spool) allAcked() bool {
+	return s.acked.seg == s.lastSegment() && s.acked.off >= s.sizes[s.acked.seg]
+}
+
+// rotate starts a new segment
+func (s *Spool) rotate() error {
+	id := s.lastSegment() + 1
+	w, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	s.w.Close()
+	s.w = w
+	s.segments = append(s.segments, id)
+	s.sizes[id] = 0
+	return nil
+}
+
+// removeOldest deletes the oldest segment, moving the read and acknowledged
+// positions past it if needed.
+func (s *Spool) removeOldest() error {
+	id := s.segments[0]
+	if err := os.Remove(s.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.total -= s.sizes[id]
+	delete(s.sizes, id)
+	s.segments = s.segments[1:]
+
+	if s.r != nil && s.rSeg == id {
+		s.r.Close()
+		s.r = nil
+	}
+	if len(s.segments) > 0 {
+		next := spoolPos{seg: s.segments[0]}
+		if s.read.seg <= id {
+			s.read = next
+		}
+		if s.acked.seg <= id {
+			s.acked = next
+			return s.saveAck()
+		}
+	}
+	return nil
+}
+
+// Read returns up to max records following those returned by the previous
+// call, waiting for some to be appended if there are none. It returns
+// ErrSpoolClosed once the spool is closed.
+func (s *Spool) Read(max int) ([][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		if s.closed {
+			return nil, ErrSpoolClosed
+		}
+		records, err := s.readLocked(max)
+		if err != nil || len(records) > 0 {
+			return records, err
+		}
+		s.cond.Wait()
+	}
+}
+
+func (s *Spool) readLocked(max int) ([][]byte, error) {
+	var records [][]byte
+	for len(records) < max {
+		if s.r == nil || s.rSeg != s.read.seg {
+			if s.r != nil {
+				s.r.Close()
+			}
+			r, err := os.Open(s.segmentPath(s.read.seg))
+			if err != nil {
+				return records, err
+			}
+			s.r, s.rSeg = r, s.read.seg
+		}
+
+		limit := s.sizes[s.read.seg]
+		data, n, err := readRecord(s.r, s.read.off, limit)
+		if err == nil {
+			records = append(records, data)
+			s.read.off += n
+			continue
+		}
+
+		// end of the segment, or the rest of it is unreadable: go on with
+		// the next one if there is one
+		if s.read.seg == s.lastSegment() {
+			if err != io.EOF {
+				s.read.off = limit
+			}
+			return records, nil
+		}
+		i := sort.Search(len(s.segments), func(i int) bool { return s.segments[i] > s.read.seg })
+		s.read = spoolPos{seg: s.segments[i]}
+	}
+	return records, nil
+}
+
+// Ack marks every record returned by Read so far as delivered. Segments
+// left behind are deleted.
+func (s *Spool) Ack() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrSpoolClosed
+	}
+	s.acked = s.read
+	if err := s.saveAck(); err != nil {
+		return err
+	}
+	for s.segments[0] < s.acked.seg {
+		if err := s.removeOldest(); err != nil {
+			return err
+		}
+	}
+	s.cond.Broadcast()
+	return nil
+}
+
+// Close the spool, waking up callers blocked in Read or Append.
+func (s *Spool) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	if s.r != nil {
+		s.r.Close()
+	}
+	return s.w.Close()
+}
+
+// BatchWriter is implemented by remote handlers which can deliver a batch
+// of records synchronously, retrying as they are configured to, and report
+// whether it succeeded.
+type BatchWriter interface {
+	WriteBatch(records [][]byte) error
+}
+
+// EntryBatchWriter is a BatchWriter for handlers which build their requests
+// from the entries, as EntryHandlers do. An entry is nil for a record
+// written with Write.
+type EntryBatchWriter interface {
+	WriteEntryBatch(entries []*Entry, records [][]byte) error
+}
+
+// batchCanceler is implemented by the BatchWriters of galog whose
+// WriteBatch may wait between retries, cancelBatch makes it give up.
+type batchCanceler interface {
+	cancelBatch()
+}
+
+// kinds of the records a SpoolHandler appends, the first byte of each
+const (
+	spoolRecordBytes byte = iota // p, from Write
+	spoolRecordEntry             // uvarint length, entry metadata, then p
+)
+
+// spooledEntry is what a SpoolHandler keeps of an entry, for its output to
+// get it back in WriteEntry. Fields are kept as encoding/json accepts them
+// and come back as it decodes them, integers as int64.
+type spooledEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   Level                  `json:"level"`
+	Name    string                 `json:"name,omitempty"`
+	Event   string                 `json:"event,omitempty"`
+	Message string                 `json:"message,omitempty"`
+	Caller  *spooledCaller         `json:"caller,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+type spooledCaller struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Function string `json:"function"`
+}
+
+// encodeSpoolRecord returns the record of p, and of the entry if not nil
+func encodeSpoolRecord(entry *Entry, p []byte) ([]byte, error) {
+	if entry == nil {
+		return append([]byte{spoolRecordBytes}, p...), nil
+	}
+
+	se := spooledEntry{
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Name:    entry.Name,
+		Event:   entry.Event,
+		Message: entry.Message,
+	}
+	if entry.Caller != nil {
+		se.Caller = &spooledCaller{entry.Caller.File, entry.Caller.Line, entry.Caller.Function}
+	}
+	if len(entry.Fields) > 0 {
+		se.Fields = make(map[string]interface{}, len(entry.Fields))
+		for k, v := range entry.Fields {
+			se.Fields[k] = jsonValue(v)
+		}
+	}
+	meta, err := json.Marshal(se)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, 0, 1+binary.MaxVarintLen64+len(meta)+len(p))
+	record = append(record, spoolRecordEntry)
+	record = binary.AppendUvarint(record, uint64(len(meta)))
+	record = append(record, meta...)
+	return append(record, p...), nil
+}
+
+// decodeSpoolRecord returns the entry and p of a record, the entry is nil
+// for a record written with Write.
+func decodeSpoolRecord(record []byte) (*Entry, []byte, error) {
+	if len(record) == 0 {
+		return nil, nil, errors.New("galog: empty spool record")
+	}
+	switch record[0] {
+	case spoolRecordBytes:
+		return nil, record[1:], nil
+	case spoolRecordEntry:
+	default:
+		return nil, nil, fmt.Errorf("galog: unknown spool record kind %d", record[0])
+	}
+
+	length, n := binary.Uvarint(record[1:])
+	if n <= 0 || length > uint64(len(record)-1-n) {
+		return nil, nil, errors.New("galog: invalid spool record length")
+	}
+	meta, p := record[1+n:1+n+int(length)], record[1+n+int(length):]
+
+	var se spooledEntry
+	d := json.NewDecoder(bytes.NewReader(meta))
+	d.UseNumber()
+	if err := d.Decode(&se); err != nil {
+		return nil, nil, fmt.Errorf("galog: invalid spool record, %v", err)
+	}
+
+	entry := &Entry{
+		Time:    se.Time,
+		Level:   se.Level,
+		Name:    se.Name,
+		Event:   se.Event,
+		Message: se.Message,
+		Fields:  make(Fields, len(se.Fields)),
+	}
+	if se.Caller != nil {
+		entry.Caller = &runtime.Frame{File: se.Caller.File, Line: se.Caller.Line, Function: se.Caller.Function}
+	}
+	for k, v := range se.Fields {
+		entry.Fields[k] = spooledValue(v)
+	}
+	return entry, p, nil
+}
+
+// spooledValue turns the numbers of a decoded field value into int64 when
+// they are integers, float64 otherwise.
+func spooledValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = spooledValue(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = spooledValue(v[k])
+		}
+	}
+	return v
+}
+
+// SpoolHandlerOptions configures a SpoolHandler, zero values use the
+// defaults.
+type SpoolHandlerOptions struct {
+	// BatchSize is the maximum number of records handed to the output at
+	// once, 500 by default
+	BatchSize int
+
+	// Backoff between attempts when the output fails. MaxRetries is
+	// ignored, records are retried until delivered or the handler closed.
+	Backoff RetryOptions
+
+	// ErrorHandler receives delivery errors, they are printed on os.Stderr
+	// by default.
+	ErrorHandler func(error)
+}
+
+// SpoolHandler stores records in a Spool and forwards them to another
+// handler from a background goroutine, so that records survive the remote
+// service, or the process, being down.
+//
+// Entries are stored along with their record, so that the output gets them
+// back in WriteEntry. Records are acknowledged in the spool once the output
+// delivered them: the remote handlers of galog implement BatchWriter or
+// EntryBatchWriter and send a batch right away, other outputs are written
+// one record at a time and then flushed, and must report failures from
+// Write, WriteEntry or Flush. Delivery is at least once: a batch that
+// partially failed is sent again in full.
+type SpoolHandler struct {
+	spool        *Spool
+	out          Handler
+	batchSize    int
+	backoff      RetryOptions
+	errorHandler func(error)
+	stop         chan struct{}
+	stopOnce     sync.Once
+	done         chan struct{}
+}
+
+// NewSpoolHandler return SpoolHandler forwarding from spool to out
+func NewSpoolHandler(spool *Spool, out Handler, opts SpoolHandlerOptions) (*SpoolHandler, error) {
+	h := new(SpoolHandler)
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultSpoolBatch
+	}
+	opts.Backoff.setDefaults()
+
+	h.spool = spool
+	h.out = out
+	h.batchSize = opts.BatchSize
+	h.backoff = opts.Backoff
+	h.errorHandler = opts.ErrorHandler
+	if h.errorHandler == nil {
+		h.errorHandler = defaultErrorHandler("Failed to forward spooled logs")
+	}
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+
+	go h.run()
+
+	return h, nil
+}
+
+// Write appends p to the spool
+func (h *SpoolHandler) Write(p []byte) (n int, err error) {
+	return h.append(nil, p)
+}
+
+// WriteEntry appends p to the spool along with the entry
+func (h *SpoolHandler) WriteEntry(entry *Entry, p []byte) (n int, err error) {
+	return h.append(entry, p)
+}
+
+func (h *SpoolHandler) append(entry *Entry, p []byte) (int, error) {
+	record, err := encodeSpoolRecord(entry, p)
+	if err != nil {
+		return 0, err
+	}
+	if err := h.spool.Append(record); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (h *SpoolHandler) run() {
+	defer close(h.done)
+	for {
+		records, err := h.spool.Read(h.batchSize)
+		if err == ErrSpoolClosed {
+			return
+		}
+		if err != nil {
+			h.errorHandler(err)
+			if !h.wait(0) {
+				return
+			}
+			continue
+		}
+
+		entries, batch := h.decode(records)
+		for attempt := 0; len(batch) > 0; attempt++ {
+			err := h.deliver(entries, batch)
+			if err == nil {
+				break
+			}
+			h.errorHandler(err)
+			if !h.wait(attempt) {
+				return
+			}
+		}
+		if err := h.spool.Ack(); err != nil && err != ErrSpoolClosed {
+			h.errorHandler(err)
+		}
+	}
+}
+
+// decode returns the entries and records of a batch read from the spool,
+// records that can not be decoded are reported and skipped.
+func (h *SpoolHandler) decode(records [][]byte) ([]*Entry, [][]byte) {
+	entries := make([]*Entry, 0, len(records))
+	batch := make([][]byte, 0, len(records))
+	for _, r := range records {
+		entry, p, err := decodeSpoolRecord(r)
+		if err != nil {
+			h.errorHandler(err)
+			continue
+		}
+		entries = append(entries, entry)
+		batch = append(batch, p)
+	}
+	return entries, batch
+}
+
+// wait before the next attempt, it returns false if the handler was closed
+func (h *SpoolHandler) wait(attempt int) bool {
+	select {
+	case <-time.After(h.backoff.backoff(attempt)):
+		return true
+	case <-h.stop:
+		return false
+	}
+}
+
+// deliver hands a batch to the output and returns once it is delivered
+func (h *SpoolHandler) deliver(entries []*Entry, records [][]byte) error {
+	switch out := h.out.(type) {
+	case EntryBatchWriter:
+		return out.WriteEntryBatch(entries, records)
+	case BatchWriter:
+		return out.WriteBatch(records)
+	}
+
+	for i, p := range records {
+		var err error
+		if entries[i] != nil {
+			_, err = writeEntry(h.out, entries[i], p)
+		} else {
+			_, err = h.out.Write(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return flush(h.out)
+}
+
+// Close stops forwarding and closes the spool and the output. Records not
+// delivered yet stay in the spool for the next run.
+func (h *SpoolHandler) Close() error {
+	first := false
+	h.stopOnce.Do(func() {
+		first = true
+		close(h.stop)
+	})
+	if !first {
+		return nil
+	}
+
+	// do not wait for the retries of a delivery in progress
+	if c, ok := h.out.(batchCanceler); ok {
+		c.cancelBatch()
+	}
+	err := h.spool.Close()
+	<-h.done
+	if cerr := h.out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
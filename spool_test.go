@@ -0,0 +1,429 @@
+package galog
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpoolHandlerDelivers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := new(collector)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	spool, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := NewHTTPHandler(srv.URL, HTTPOptions{})
+	h, _ := NewSpoolHandler(spool, out, SpoolHandlerOptions{})
+	h.Write([]byte("one\n"))
+	h.Write([]byte("two\n"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Join(c.received(), "") != "one\ntwo\n" {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %q", c.received())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	// acknowledged records are not read again
+	spool, err = OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	spool.Append([]byte("three\n"))
+	records, err := spool.Read(10)
+	if err != nil || len(records) != 1 || string(records[0]) != "three\n" {
+		t.Fatalf("records %q, %v", records, err)
+	}
+}
+
+func TestSpoolHandlerCloseDuringRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	spool, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := NewHTTPHandler(srv.URL, HTTPOptions{
+		RetryOptions: RetryOptions{MaxRetries: 100, MinBackoff: time.Minute, MaxBackoff: time.Minute},
+	})
+	h, _ := NewSpoolHandler(spool, out, SpoolHandlerOptions{ErrorHandler: func(error) {}})
+	h.Write([]byte("stuck\n"))
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		h.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the retries of the output")
+	}
+
+	// the record stays in the spool for the next run
+	spool, err = OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	records, err := spool.Read(10)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("records %q, %v", records, err)
+	}
+	if _, p, err := decodeSpoolRecord(records[0]); err != nil || string(p) != "stuck\n" {
+		t.Fatalf("record %q, %v", p, err)
+	}
+}
+
+// entryOutput records what it is handed, its Flush fails a number of times
+type entryOutput struct {
+	mutex      sync.Mutex
+	entries    []*Entry
+	records    []string
+	flushFails int
+	flushed    int
+}
+
+func (o *entryOutput) Write(p []byte) (int, error) {
+	return o.WriteEntry(nil, p)
+}
+
+func (o *entryOutput) WriteEntry(entry *Entry, p []byte) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.entries = append(o.entries, entry)
+	o.records = append(o.records, string(p))
+	return len(p), nil
+}
+
+func (o *entryOutput) Flush() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.flushFails > 0 {
+		o.flushFails--
+		return errors.New("flush failed")
+	}
+	o.flushed++
+	return nil
+}
+
+func (o *entryOutput) Close() error { return nil }
+
+func TestSpoolHandlerEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &entryOutput{flushFails: 1}
+	var errs lockedBuffer
+	h, _ := NewSpoolHandler(spool, out, SpoolHandlerOptions{
+		Backoff:      RetryOptions{MinBackoff: time.Millisecond},
+		ErrorHandler: func(err error) { errs.WriteString(err.Error()) },
+	})
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h.WriteEntry(&Entry{
+		Time:   at,
+		Level:  WarnLevel,
+		Name:   "battle",
+		Event:  "playerlogin",
+		Caller: &runtime.Frame{File: "main.go", Line: 42, Function: "main.main"},
+		Fields: Fields{"zone_id": 1, "ratio": 0.5, "err": errors.New("boom")},
+	}, []byte("entry\n"))
+	h.Write([]byte("plain\n"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		out.mutex.Lock()
+		flushed := out.flushed
+		out.mutex.Unlock()
+		if flushed > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("records not delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	h.Close()
+
+	// the failed flush is reported and the batch written again
+	if errs.String() != "flush failed" {
+		t.Errorf("errors %q", errs.String())
+	}
+	want := []string{"entry\n", "plain\n", "entry\n", "plain\n"}
+	if strings.Join(out.records, "") != strings.Join(want, "") {
+		t.Fatalf("records %q, want %q", out.records, want)
+	}
+
+	e := out.entries[2]
+	if e == nil || !e.Time.Equal(at) || e.Level != WarnLevel || e.Name != "battle" || e.Event != "playerlogin" {
+		t.Fatalf("entry %+v", e)
+	}
+	if e.Caller == nil || e.Caller.File != "main.go" || e.Caller.Line != 42 || e.Caller.Function != "main.main" {
+		t.Errorf("caller %+v", e.Caller)
+	}
+	if e.Fields["zone_id"] != int64(1) || e.Fields["ratio"] != 0.5 || e.Fields["err"] != "boom" {
+		t.Errorf("fields %#v", e.Fields)
+	}
+	if out.entries[3] != nil {
+		t.Errorf("entry %+v for a record written with Write", out.entries[3])
+	}
+}
+
+func TestSpoolHandlerForward(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newForwardServer(t, 0)
+	spool, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := NewForwardHandler("tcp", s.l.Addr().String(), ForwardOptions{RequireAck: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := NewSpoolHandler(spool, out, SpoolHandlerOptions{})
+	defer h.Close()
+
+	h.WriteEntry(&Entry{Time: time.Now(), Level: ErrorLevel, Event: "playerlogin"}, []byte("login\n"))
+
+	// sent right away, not left in the queue of the handler
+	msg := s.next(t)
+	if msg[0] != "galog.playerlogin" {
+		t.Fatalf("tag %v", msg[0])
+	}
+	record := msg[1].([]interface{})[0].([]interface{})[1].(map[string]interface{})
+	if record["level"] != "error" || record["message"] != "login" {
+		t.Errorf("record %v", record)
+	}
+}
+
+func TestSpoolReplayAfterCrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []string{"one", "two", "three"} {
+		if err := spool.Append([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spool.Close()
+
+	// the last record is corrupted and followed by a torn header
+	seg := spool.segmentPath(spool.lastSegment())
+	b, err := ioutil.ReadFile(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 0xff
+	b = append(b, 5, 0, 0)
+	if err := ioutil.WriteFile(seg, b, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	spool, err = OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	records, err := spool.Read(10)
+	if err != nil || len(records) != 2 || string(records[0]) != "one" || string(records[1]) != "two" {
+		t.Fatalf("records %q, %v", records, err)
+	}
+
+	// appended after the valid records, in place of the damaged ones
+	if err := spool.Append([]byte("four")); err != nil {
+		t.Fatal(err)
+	}
+	records, err = spool.Read(10)
+	if err != nil || len(records) != 1 || string(records[0]) != "four" {
+		t.Fatalf("records %q, %v", records, err)
+	}
+}
+
+// spoolRecord returns a record of n bytes, its index and padding
+func spoolRecord(i int, n int) []byte {
+	return []byte(fmt.Sprintf("%-*d", n, i))
+}
+
+func TestSpoolDropOldest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// two records of 18 bytes with their header per segment, four in all
+	spool, err := OpenSpool(dir, SpoolOptions{SegmentBytes: 40, MaxBytes: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	for i := 0; i < 6; i++ {
+		if err := spool.Append(spoolRecord(i, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first segment, with records 0 and 1, was deleted
+	records, err := spool.Read(10)
+	if err != nil || len(records) != 4 {
+		t.Fatalf("records %q, %v", records, err)
+	}
+	for i, r := range records {
+		if string(r) != string(spoolRecord(i+2, 10)) {
+			t.Errorf("record %d %q", i, r)
+		}
+	}
+}
+
+func TestSpoolBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := OpenSpool(dir, SpoolOptions{SegmentBytes: 40, MaxBytes: 40, Policy: Block})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	spool.Append(spoolRecord(0, 10))
+	spool.Append(spoolRecord(1, 10))
+
+	appended := make(chan error, 1)
+	go func() { appended <- spool.Append(spoolRecord(2, 10)) }()
+	select {
+	case err := <-appended:
+		t.Fatalf("Append on a full spool returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if records, err := spool.Read(10); err != nil || len(records) != 2 {
+		t.Fatalf("records %q, %v", records, err)
+	}
+	if err := spool.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-appended:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Append still blocked once the records were acknowledged")
+	}
+	records, err := spool.Read(10)
+	if err != nil || len(records) != 1 || string(records[0]) != string(spoolRecord(2, 10)) {
+		t.Fatalf("records %q, %v", records, err)
+	}
+}
+
+func TestSpoolRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	segments := func() []string {
+		files, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+		return files
+	}
+
+	spool, err := OpenSpool(dir, SpoolOptions{SegmentBytes: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		spool.Append(spoolRecord(i, 10))
+	}
+	if files := segments(); len(files) != 3 {
+		t.Fatalf("segments %v, want 3", files)
+	}
+
+	records, err := spool.Read(3)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("records %q, %v", records, err)
+	}
+	if err := spool.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	// the first segment is done with, the second one is still being read
+	if files := segments(); len(files) != 2 {
+		t.Fatalf("segments %v after Ack, want 2", files)
+	}
+	spool.Close()
+
+	// reopened at the acknowledged position
+	spool, err = OpenSpool(dir, SpoolOptions{SegmentBytes: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	records, err = spool.Read(10)
+	if err != nil || len(records) != 2 || string(records[0]) != string(spoolRecord(3, 10)) {
+		t.Fatalf("records %q, %v", records, err)
+	}
+	if err := spool.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if files := segments(); len(files) != 1 {
+		t.Fatalf("segments %v after Ack, want 1", files)
+	}
+}
@@ -0,0 +1,46 @@
+package galog
+
+import (
+	"log"
+	"strings"
+)
+
+// stdLogWriter is the io.Writer behind the loggers of NewStdLogger, each
+// write of the standard library logger is one line.
+type stdLogWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (w stdLogWriter) Write(p []byte) (int, error) {
+	if !w.logger.IsLevelEnabled(w.level) {
+		return len(p), nil
+	}
+	if err := w.logger.log(w.level, strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewStdLogger returns a standard library logger writing into logger at
+// level, for the libraries taking a *log.Logger. The lines go through the
+// hooks, formatter and output of logger, which adds the time and caller, so
+// the returned logger has no flags.
+func NewStdLogger(logger *Logger, level Level) *log.Logger {
+	return log.New(stdLogWriter{logger, level}, "", 0)
+}
+
+// RedirectStdLog makes the standard library default logger, used by the
+// functions of the log package, write into logger at level. The returned
+// function restores its previous output, prefix and flags.
+func (logger *Logger) RedirectStdLog(level Level) (restore func()) {
+	flags, prefix, out := log.Flags(), log.Prefix(), log.Writer()
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(stdLogWriter{logger, level})
+	return func() {
+		log.SetOutput(out)
+		log.SetPrefix(prefix)
+		log.SetFlags(flags)
+	}
+}
@@ -0,0 +1,36 @@
+package galog
+
+import (
+	"log"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	out := new(entryOutput)
+	logger := New()
+	logger.SetOutput(out)
+
+	NewStdLogger(logger, WarnLevel).Print("hello")
+	NewStdLogger(logger, DebugLevel).Print("filtered")
+	if len(out.entries) != 1 || out.entries[0].Level != WarnLevel || out.entries[0].Message != "hello" {
+		t.Fatalf("entries %+v", out.entries)
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	out := new(entryOutput)
+	logger := New()
+	logger.SetOutput(out)
+
+	saved := log.Writer()
+	restore := logger.RedirectStdLog(ErrorLevel)
+	log.Printf("failed %d times", 3)
+	restore()
+
+	if len(out.entries) != 1 || out.entries[0].Level != ErrorLevel || out.entries[0].Message != "failed 3 times" {
+		t.Fatalf("entries %+v", out.entries)
+	}
+	if log.Writer() != saved {
+		t.Error("output of the standard logger not restored")
+	}
+}
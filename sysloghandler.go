@@ -0,0 +1,356 @@
+package galog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Facility is a syslog facility, see RFC 5424 section 6.2.1. The zero
+// value stands for the default, FacilityUser.
+type Facility int
+
+const (
+	// FacilityKern is reserved for the kernel, NewSyslogHandler rejects it
+	FacilityKern Facility = iota + 1
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLpr
+	FacilityNews
+	FacilityUucp
+	FacilityCron
+	FacilityAuthpriv
+	FacilityFtp
+	_ // ntp
+	_ // security
+	_ // console
+	_ // solaris-cron
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// syslog severities, RFC 5424 section 6.2.1
+const (
+	severityEmerg = iota
+	severityAlert
+	severityCrit
+	severityErr
+	severityWarning
+	severityNotice
+	severityInfo
+	severityDebug
+)
+
+// SyslogFormat selects the syslog message format
+type SyslogFormat int
+
+const (
+	// RFC5424 is the current syslog protocol
+	RFC5424 SyslogFormat = iota
+	// RFC3164 is the legacy BSD syslog format, still expected by some local
+	// daemons
+	RFC3164
+)
+
+const (
+	defaultSyslogMaxBackoff = 30 * time.Second
+	minSyslogBackoff        = 100 * time.Millisecond
+	syslogTimestamp5424     = "2006-01-02T15:04:05.000000Z07:00"
+	syslogTimestamp3164     = "Jan _2 15:04:05"
+
+	// lengths of the header fields, RFC 5424 section 6
+	maxSyslogHostname = 255
+	maxSyslogAppName  = 48
+	maxSyslogMsgID    = 32
+)
+
+// ErrSyslogUnavailable is returned by SyslogHandler while it waits before
+// reconnecting to the server.
+var ErrSyslogUnavailable = errors.New("galog: syslog server unavailable")
+
+// SyslogOptions configures a SyslogHandler, zero values use the defaults.
+type SyslogOptions struct {
+	// Format of the messages, RFC5424 by default
+	Format SyslogFormat
+
+	// Facility of the messages, FacilityUser by default
+	Facility Facility
+
+	// AppName identifies the program, the base name of os.Args[0] by
+	// default. Characters other than printable ASCII are replaced by '_',
+	// and it is cut to 48 bytes.
+	AppName string
+
+	// Hostname sent in messages, os.Hostname() by default. It is cleaned
+	// like AppName and cut to 255 bytes. The name of the logger is sent as
+	// MSGID, cleaned the same way and cut to 32 bytes.
+	Hostname string
+
+	// StructuredData is added verbatim to RFC 5424 messages, e.g.
+	// `[galog@32473 zone="1"]`. Ignored for RFC 3164.
+	StructuredData string
+
+	// NonTransparentFraming terminates messages on stream transports (tcp,
+	// unix) with a newline instead of prefixing them with their length, see
+	// RFC 6587.
+	NonTransparentFraming bool
+
+	// MaxBackoff caps the wait between reconnection attempts, 30s by default
+	MaxBackoff time.Duration
+}
+
+// SyslogHandler sends logs to a syslog server over udp, tcp, unix or
+// unixgram sockets, mapping galog levels to syslog severities.
+//
+// When the connection fails the handler reconnects, waiting longer after
+// each failed attempt up to MaxBackoff. Messages logged while waiting are
+// dropped and ErrSyslogUnavailable is returned. Once closed, writes return
+// os.ErrClosed.
+type SyslogHandler struct {
+	conn   net.Conn
+	closed bool
+
+	network  string
+	addr     string
+	opts     SyslogOptions
+	hostname string
+	pid      string
+	backoff  time.Duration
+	retryAt  time.Time
+	mutex    sync.Mutex
+}
+
+// NewSyslogHandler return SyslogHandler. An empty network connects to the
+// local syslog daemon through its unix socket.
+func NewSyslogHandler(network string, addr string, opts SyslogOptions) (*SyslogHandler, error) {
+	h := new(SyslogHandler)
+
+	if opts.Facility == 0 {
+		opts.Facility = FacilityUser
+	}
+	if opts.Facility == FacilityKern {
+		return nil, errors.New("galog: the kern syslog facility is reserved for the kernel")
+	}
+	if opts.Facility < FacilityKern || opts.Facility > FacilityLocal7 {
+		return nil, fmt.Errorf("invalid syslog facility: %d", opts.Facility)
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	opts.AppName = syslogHeaderField(opts.AppName, maxSyslogAppName)
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultSyslogMaxBackoff
+	}
+
+	h.network = network
+	h.addr = addr
+	h.opts = opts
+	h.pid = strconv.Itoa(os.Getpid())
+	h.hostname = opts.Hostname
+	if h.hostname == "" {
+		h.hostname, _ = os.Hostname()
+	}
+	h.hostname = syslogHeaderField(h.hostname, maxSyslogHostname)
+
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *SyslogHandler) connect() error {
+	if h.network != "" {
+		conn, err := net.Dial(h.network, h.addr)
+		if err != nil {
+			return err
+		}
+		h.conn = conn
+		return nil
+	}
+
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+			conn, err := net.Dial(network, path)
+			if err == nil {
+				h.conn = conn
+				return nil
+			}
+		}
+	}
+	return errors.New("galog: unix syslog delivery error")
+}
+
+// Write p with the severity of InfoLevel
+func (h *SyslogHandler) Write(p []byte) (n int, err error) {
+	return h.write(time.Now(), InfoLevel, "", p)
+}
+
+// WriteEntry writes p with the severity mapped from the entry level
+func (h *SyslogHandler) WriteEntry(entry *Entry, p []byte) (n int, err error) {
+	return h.write(entry.Time, entry.Level, entry.Name, p)
+}
+
+func (h *SyslogHandler) write(t time.Time, level Level, name string, p []byte) (n int, err error) {
+	buffer := getBuffer()
+	defer putBuffer(buffer)
+
+	h.format(buffer, t, level, name, bytes.TrimRight(p, "\n"))
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	if h.conn == nil {
+		if time.Now().Before(h.retryAt) {
+			return 0, ErrSyslogUnavailable
+		}
+		if err := h.reconnect(); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = h.send(buffer.Bytes()); err != nil {
+		// the server may just have restarted, try once more right away
+		h.conn.Close()
+		h.conn = nil
+		if err = h.reconnect(); err != nil {
+			return 0, err
+		}
+		if err = h.send(buffer.Bytes()); err != nil {
+			h.conn.Close()
+			h.conn = nil
+			h.retryAt = time.Now().Add(h.nextBackoff())
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// reconnect dials the server, on failure the next attempt is delayed.
+func (h *SyslogHandler) reconnect() error {
+	if err := h.connect(); err != nil {
+		h.retryAt = time.Now().Add(h.nextBackoff())
+		return err
+	}
+	h.backoff = 0
+	return nil
+}
+
+func (h *SyslogHandler) nextBackoff() time.Duration {
+	if h.backoff == 0 {
+		h.backoff = minSyslogBackoff
+	} else {
+		h.backoff *= 2
+	}
+	if h.backoff > h.opts.MaxBackoff {
+		h.backoff = h.opts.MaxBackoff
+	}
+	return h.backoff
+}
+
+func (h *SyslogHandler) send(msg []byte) error {
+	var err error
+	switch {
+	case !h.stream():
+		_, err = h.conn.Write(msg)
+	case h.opts.NonTransparentFraming:
+		_, err = h.conn.Write(append(msg, '\n'))
+	default:
+		_, err = fmt.Fprintf(h.conn, "%d %s", len(msg), msg)
+	}
+	return err
+}
+
+func (h *SyslogHandler) stream() bool {
+	switch h.conn.LocalAddr().Network() {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return true
+	}
+	return false
+}
+
+func (h *SyslogHandler) format(buffer *bytes.Buffer, t time.Time, level Level, name string, msg []byte) {
+	pri := (int(h.opts.Facility)-1)*8 + syslogSeverity(level)
+
+	if h.opts.Format == RFC3164 {
+		fmt.Fprintf(buffer, "<%d>%s %s %s[%s]: ", pri, t.Format(syslogTimestamp3164), h.hostname, h.opts.AppName, h.pid)
+		buffer.Write(msg)
+		return
+	}
+
+	msgID := syslogHeaderField(name, maxSyslogMsgID)
+	sd := h.opts.StructuredData
+	if sd == "" {
+		sd = "-"
+	}
+	fmt.Fprintf(buffer, "<%d>1 %s %s %s %s %s %s ", pri, t.Format(syslogTimestamp5424), h.hostname, h.opts.AppName, h.pid, msgID, sd)
+	buffer.Write(msg)
+}
+
+// syslogHeaderField returns s as a header field of at most max bytes:
+// characters other than printable ASCII replaced by '_', "-" if empty
+func syslogHeaderField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if len(b) == max {
+			break
+		}
+		if r < '!' || r > '~' {
+			r = '_'
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
+
+// syslogSeverity maps a galog level to a syslog severity
+func syslogSeverity(level Level) int {
+	switch level {
+	case PanicLevel:
+		return severityEmerg
+	case FatalLevel:
+		return severityCrit
+	case ErrorLevel:
+		return severityErr
+	case WarnLevel:
+		return severityWarning
+	case InfoLevel:
+		return severityInfo
+	default:
+		return severityDebug
+	}
+}
+
+// Close the connection to the server
+func (h *SyslogHandler) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.closed = true
+	if h.conn != nil {
+		err := h.conn.Close()
+		h.conn = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package galog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogHandlerUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	h, err := NewSyslogHandler("udp", conn.LocalAddr().String(), SyslogOptions{
+		AppName:  "game server",
+		Hostname: "host-é",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	entry := &Entry{Time: time.Now(), Level: ErrorLevel, Name: strings.Repeat("n", 40)}
+	if _, err := h.WriteEntry(entry, []byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.SplitN(string(buf[:n]), " ", 8)
+	if len(fields) != 8 {
+		t.Fatalf("got %q", buf[:n])
+	}
+	// user facility, err severity
+	if fields[0] != "<11>1" {
+		t.Errorf("PRI and version %q, want <11>1", fields[0])
+	}
+	if fields[2] != "host-_" {
+		t.Errorf("HOSTNAME %q, want host-_", fields[2])
+	}
+	if fields[3] != "game_server" {
+		t.Errorf("APP-NAME %q, want game_server", fields[3])
+	}
+	if fields[4] != strconv.Itoa(os.Getpid()) {
+		t.Errorf("PROCID %q", fields[4])
+	}
+	if fields[5] != strings.Repeat("n", maxSyslogMsgID) {
+		t.Errorf("MSGID %q, want 32 bytes", fields[5])
+	}
+	if fields[6] != "-" || fields[7] != "hello" {
+		t.Errorf("SD and MSG %q %q", fields[6], fields[7])
+	}
+}
+
+func TestSyslogHandlerTCPFraming(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSuffix(length, " "))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	h, err := NewSyslogHandler("tcp", l.Addr().String(), SyslogOptions{Format: RFC3164, Facility: FacilityLocal0, AppName: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		// local0, info
+		if !strings.HasPrefix(msg, "<134>") || !strings.HasSuffix(msg, " app["+strconv.Itoa(os.Getpid())+"]: first") {
+			t.Errorf("got %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing received")
+	}
+
+	h.Close()
+	if _, err := h.Write([]byte("after close")); err != os.ErrClosed {
+		t.Errorf("write after Close returned %v, want os.ErrClosed", err)
+	}
+}
+
+func TestSyslogHandlerKern(t *testing.T) {
+	if _, err := NewSyslogHandler("udp", "127.0.0.1:514", SyslogOptions{Facility: FacilityKern}); err == nil {
+		t.Error("FacilityKern accepted")
+	}
+}